@@ -0,0 +1,109 @@
+package main
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ndau/writers/pkg/filter"
+)
+
+// interpreters maps the names accepted by -interpreters to constructors.
+// Each constructor is given the fields collected from -set.
+var interpreters = map[string]func(defaults map[string]interface{}) filter.Interpreter{
+	"json": func(map[string]interface{}) filter.Interpreter {
+		// we're only ever going to write the numbers back out, so keep them exact
+		return filter.JSONInterpreter{UseNumber: true}
+	},
+	"tendermint": func(map[string]interface{}) filter.Interpreter {
+		return filter.NewTendermintInterpreter()
+	},
+	"tendermint-text": func(map[string]interface{}) filter.Interpreter {
+		return filter.TendermintTextInterpreter{}
+	},
+	"consensus": func(map[string]interface{}) filter.Interpreter {
+		return filter.NewConsensusInterpreter()
+	},
+	"logfmt": func(map[string]interface{}) filter.Interpreter {
+		return filter.LogfmtInterpreter{Coerce: true}
+	},
+	"redis": func(map[string]interface{}) filter.Interpreter {
+		return filter.RedisInterpreter{}
+	},
+	"syslog": func(map[string]interface{}) filter.Interpreter {
+		return filter.SyslogInterpreter{}
+	},
+	"access-log": func(map[string]interface{}) filter.Interpreter {
+		// the format is a constant, so it can't fail
+		i, _ := filter.NewAccessLogInterpreter(filter.CombinedLogFormat)
+		return i
+	},
+	"level": func(map[string]interface{}) filter.Interpreter {
+		return filter.LevelInterpreter{}
+	},
+	"timestamp": func(map[string]interface{}) filter.Interpreter {
+		return filter.TimestampInterpreter{}
+	},
+	"required": func(defaults map[string]interface{}) filter.Interpreter {
+		return filter.RequiredFieldsInterpreter{Defaults: defaults}
+	},
+	"last-chance": func(map[string]interface{}) filter.Interpreter {
+		return filter.LastChanceInterpreter{}
+	},
+}
+
+// aliases are alternative spellings of interpreter names
+var aliases = map[string]string{
+	"required-fields": "required",
+	"lastchance":      "last-chance",
+}
+
+// interpreterNames returns the names of the interpreters, sorted.
+func interpreterNames() []string {
+	names := make([]string, 0, len(interpreters))
+	for name := range interpreters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// buildInterpreters constructs the chain of interpreters from a comma-separated
+// list of names. If there are any defaults and the list doesn't mention the
+// required interpreter, one is put at the front of the chain, so that the
+// record's own fields take precedence.
+func buildInterpreters(list string, defaults map[string]interface{}) ([]filter.Interpreter, error) {
+	chain := []filter.Interpreter{}
+	haveRequired := false
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if alias, ok := aliases[name]; ok {
+			name = alias
+		}
+		build, ok := interpreters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown interpreter %q (known: %s)", name, strings.Join(interpreterNames(), ", "))
+		}
+		if name == "required" {
+			haveRequired = true
+		}
+		chain = append(chain, build(defaults))
+	}
+	if len(defaults) > 0 && !haveRequired {
+		chain = append([]filter.Interpreter{filter.RequiredFieldsInterpreter{Defaults: defaults}}, chain...)
+	}
+	return chain, nil
+}
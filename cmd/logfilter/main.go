@@ -0,0 +1,188 @@
+// logfilter reads captured log output from stdin or from files, runs it through
+// a filter.Filter, and writes the resulting records to stdout.
+//
+// Usage:
+//
+//	logfilter [flags] [file ...]
+//
+// With no files, or a file named "-", it reads stdin. See -help for the flags.
+package main
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ndau/writers/pkg/bufio"
+	"github.com/ndau/writers/pkg/encoder"
+	"github.com/ndau/writers/pkg/filter"
+)
+
+// stringList is a flag.Value that accumulates every use of a repeatable flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// splitters maps the names accepted by -split to split functions
+var splitters = map[string]bufio.SplitFunc{
+	"json":  filter.JSONSplit,
+	"lines": bufio.ScanLines,
+	"redis": filter.RedisSplit,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run does all the work of main, but is testable; it returns the exit code.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("logfilter", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	split := flags.String("split", "json", "how to split the input into records: json, lines or redis")
+	terps := flags.String("interpreters", "json,tendermint,last-chance",
+		"comma-separated list of interpreters to run, in order: "+strings.Join(interpreterNames(), ", "))
+	format := flags.String("format", "json", "output format: json, json-pretty, logfmt, logfmt-pretty or console")
+	color := flags.String("color", "auto", "use ANSI colors in console output: auto, always or never")
+	panics := flags.Bool("panics", false, "gather each Go panic or goroutine dump into a single record")
+	var sets stringList
+	flags.Var(&sets, "set", "`key=value` to add to every record (repeatable); used by the required interpreter, "+
+		"which is put first in the chain if it isn't listed")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: logfilter [flags] [file ...]\n\n")
+		fmt.Fprintf(stderr, "Reads log output from the files (or stdin), interprets it, and writes records to stdout.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	splitter, ok := splitters[*split]
+	if !ok {
+		fmt.Fprintf(stderr, "logfilter: unknown splitter %q\n", *split)
+		return 2
+	}
+	defaults, err := parseSets(sets)
+	if err != nil {
+		fmt.Fprintf(stderr, "logfilter: %s\n", err)
+		return 2
+	}
+	chain, err := buildInterpreters(*terps, defaults)
+	if err != nil {
+		fmt.Fprintf(stderr, "logfilter: %s\n", err)
+		return 2
+	}
+	if *panics {
+		splitter = filter.GoPanicSplit(splitter)
+		chain = append([]filter.Interpreter{filter.GoPanicInterpreter{}}, chain...)
+	}
+	sink, err := buildSink(*format, *color, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "logfilter: %s\n", err)
+		return 2
+	}
+
+	f := filter.NewWithSink(splitter, sink, filter.WithInterpreters(chain...))
+	status := 0
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	for _, name := range inputs {
+		if err := copyInput(f, name, stdin); err != nil {
+			fmt.Fprintf(stderr, "logfilter: %s\n", err)
+			status = 1
+		}
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(stderr, "logfilter: %s\n", err)
+		status = 1
+	}
+	return status
+}
+
+// copyInput copies the named file (or stdin, for "-") into the filter.
+func copyInput(w io.Writer, name string, stdin io.Reader) error {
+	if name == "-" {
+		_, err := io.Copy(w, stdin)
+		return err
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// parseSets turns the -set flags into the defaults for a RequiredFieldsInterpreter.
+func parseSets(sets []string) (map[string]interface{}, error) {
+	defaults := make(map[string]interface{}, len(sets))
+	for _, s := range sets {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("-set %q is not of the form key=value", s)
+		}
+		defaults[kv[0]] = kv[1]
+	}
+	return defaults, nil
+}
+
+// buildSink constructs the sink for the named output format.
+func buildSink(format string, color string, stdout io.Writer) (filter.Sink, error) {
+	switch format {
+	case "json":
+		return filter.NewJSONSink(stdout), nil
+	case "json-pretty":
+		return filter.NewEncoderSink(stdout, encoder.JSON{Pretty: true}), nil
+	case "logfmt":
+		return filter.NewLogfmtSink(stdout), nil
+	case "logfmt-pretty":
+		return filter.NewEncoderSink(stdout, encoder.Logfmt{Pretty: true}), nil
+	case "console":
+		useColor := false
+		switch color {
+		case "always":
+			useColor = true
+		case "never":
+		case "auto":
+			useColor = isTerminal(stdout)
+		default:
+			return nil, fmt.Errorf("unknown -color setting %q", color)
+		}
+		return filter.NewConsoleSink(stdout, useColor), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// isTerminal makes a reasonable guess at whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
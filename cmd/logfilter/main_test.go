@@ -0,0 +1,150 @@
+package main
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runWith(t *testing.T, input string, args ...string) (int, string, string) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	status := run(args, strings.NewReader(input), stdout, stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestRunJSON(t *testing.T) {
+	status, out, errs := runWith(t, `{"b":1,"level":"info"} trailing words`,
+		"-set", "node=mainnet-0")
+	assert.Equal(t, 0, status)
+	assert.Empty(t, errs)
+	assert.Equal(t, `{"level":"info","b":1,"node":"mainnet-0"}`+"\n"+
+		`{"_msg":"trailing words","node":"mainnet-0"}`+"\n", out)
+}
+
+func TestRunExactNumbers(t *testing.T) {
+	status, out, _ := runWith(t, `{"height":9007199254740993}`)
+	assert.Equal(t, 0, status)
+	assert.Equal(t, `{"height":9007199254740993}`+"\n", out)
+}
+
+func TestRunRedisLogfmt(t *testing.T) {
+	input := "66940:M 18 Apr 2019 15:18:28.569 * Ready to accept connections\n"
+	status, out, errs := runWith(t, input,
+		"-split", "lines", "-interpreters", "redis", "-format", "logfmt")
+	assert.Equal(t, 0, status)
+	assert.Empty(t, errs)
+	assert.Equal(t, `timestamp=2019-04-18T15:18:28.569Z level=info msg="Ready to accept connections" event=ready pid=66940 role=master`+"\n", out)
+}
+
+func TestRunTendermintText(t *testing.T) {
+	input := "I[2019-04-18|15:18:28.565] Executed block                               module=state height=5\n"
+	status, out, errs := runWith(t, input,
+		"-split", "lines", "-interpreters", "tendermint-text", "-format", "logfmt")
+	assert.Equal(t, 0, status)
+	assert.Empty(t, errs)
+	assert.Equal(t, `timestamp=2019-04-18T15:18:28.565Z level=info module=state msg="Executed block" height=5`+"\n", out)
+}
+
+func TestRunLevel(t *testing.T) {
+	status, out, errs := runWith(t, `{"lvl":"W","msg":"hi"}`, "-interpreters", "json,level", "-format", "logfmt")
+	assert.Equal(t, 0, status)
+	assert.Empty(t, errs)
+	assert.Equal(t, `level=warn msg=hi level_original=W lvl=W`+"\n", out)
+}
+
+func TestRunTimestamp(t *testing.T) {
+	status, out, errs := runWith(t, `{"ts":1555600708565,"msg":"hi"}`, "-interpreters", "json,timestamp", "-format", "logfmt")
+	assert.Equal(t, 0, status)
+	assert.Empty(t, errs)
+	assert.Equal(t, `timestamp=2019-04-18T15:18:28.565Z msg=hi ts=1555600708565`+"\n", out)
+}
+
+func TestRunPanics(t *testing.T) {
+	input := "starting\npanic: oops\n\ngoroutine 1 [running]:\nmain.main()\n\t/tmp/x.go:3 +0x1\n"
+	status, out, errs := runWith(t, input, "-split", "lines", "-interpreters", "last-chance", "-panics")
+	assert.Equal(t, 0, status)
+	assert.Empty(t, errs)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Equal(t, 2, len(lines), out)
+	assert.Equal(t, `{"_other":"starting"}`, lines[0])
+	assert.Contains(t, lines[1], `"panic":"oops"`)
+	assert.Contains(t, lines[1], `"function":"main.main"`)
+}
+
+func TestRunConsole(t *testing.T) {
+	status, out, _ := runWith(t, "hello\n",
+		"-split", "lines", "-interpreters", "last-chance", "-format", "console", "-color", "always")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "\x1b[1mhello\x1b[0m\n", strings.TrimLeft(out, " "))
+}
+
+func TestRunFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfilter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.log")
+	b := filepath.Join(dir, "b.log")
+	require.NoError(t, ioutil.WriteFile(a, []byte("one\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(b, []byte("two\n"), 0644))
+
+	status, out, _ := runWith(t, "from stdin\n", "-split", "lines", "-interpreters", "lastchance", a, "-", b)
+	assert.Equal(t, 0, status)
+	assert.Equal(t, `{"_other":"one"}`+"\n"+`{"_other":"from stdin"}`+"\n"+`{"_other":"two"}`+"\n", out)
+
+	status, _, errs := runWith(t, "", filepath.Join(dir, "missing.log"))
+	assert.Equal(t, 1, status)
+	assert.Contains(t, errs, "missing.log")
+}
+
+func TestRunBadFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"-split", "words"},
+		{"-interpreters", "json,nonsense"},
+		{"-format", "xml"},
+		{"-format", "console", "-color", "sometimes"},
+		{"-set", "novalue"},
+		{"-nosuchflag"},
+	} {
+		status, out, errs := runWith(t, "", args...)
+		assert.Equal(t, 2, status, "%v", args)
+		assert.Empty(t, out)
+		assert.NotEmpty(t, errs)
+	}
+}
+
+func TestBuildInterpreters(t *testing.T) {
+	defaults := map[string]interface{}{"a": "b"}
+
+	chain, err := buildInterpreters("json, Tendermint,last-chance", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(chain))
+	assert.Equal(t, filter.JSONInterpreter{UseNumber: true}, chain[0])
+	assert.IsType(t, filter.LastChanceInterpreter{}, chain[2])
+
+	// defaults go first unless placed explicitly
+	chain, err = buildInterpreters("json", defaults)
+	require.NoError(t, err)
+	assert.Equal(t, []filter.Interpreter{filter.RequiredFieldsInterpreter{Defaults: defaults}, filter.JSONInterpreter{UseNumber: true}}, chain)
+
+	chain, err = buildInterpreters("json,required-fields", defaults)
+	require.NoError(t, err)
+	assert.Equal(t, []filter.Interpreter{filter.JSONInterpreter{UseNumber: true}, filter.RequiredFieldsInterpreter{Defaults: defaults}}, chain)
+}
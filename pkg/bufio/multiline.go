@@ -0,0 +1,151 @@
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+package bufio
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+)
+
+// Multiline describes how to join lines of text into records, for things like
+// stack traces, indented continuation lines, and lines continued with a backslash.
+// Its SplitFunc method builds a split function that returns each record as a
+// single token, with the lines joined by newlines. Lines are found the same way
+// as ScanLines finds them, so carriage returns before the newlines are dropped,
+// and the last line is returned even if it has no newline.
+//
+// A line that matches Start always begins a new record. Otherwise, if Continue
+// is set, a line that matches it is added to the record before it; if only Start
+// is set, every line that doesn't match it is added to the record before it.
+// A line after one that matches Continued is always added to the record, so that
+// `\\$` joins lines that end in a backslash. With none of these set, every line
+// is a record of its own.
+//
+// A record ends early if it has MaxLines lines, or if adding the next line would
+// make it more than MaxBytes long; zero means no limit.
+//
+// To know where a record ends, the split function has to see the line after it.
+// If Idle is set, it doesn't wait for that line for longer than Idle: when the
+// split function is called and no new data has arrived for that long, or new data
+// has arrived after that long, the complete lines it already had are taken to be
+// the end of the record. Clock tells the time; if it is nil, time.Now is used.
+type Multiline struct {
+	Start     *regexp.Regexp
+	Continue  *regexp.Regexp
+	Continued *regexp.Regexp
+	MaxLines  int
+	MaxBytes  int
+	Idle      time.Duration
+	Clock     func() time.Time
+}
+
+// SplitFunc returns a split function that joins lines as described by m.
+// The split function keeps track of when data arrives, so each Scanner needs
+// one of its own.
+func (m Multiline) SplitFunc() SplitFunc {
+	clock := m.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	// seen is how much of the data had arrived when we were last called, and
+	// arrived is when more of it last arrived. final is how much of the data
+	// is to be treated as if it were at EOF, because it has been idle.
+	seen := 0
+	final := 0
+	var arrived time.Time
+
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if m.Idle > 0 && !atEOF {
+			now := clock()
+			if len(data) > seen {
+				if seen > 0 && now.Sub(arrived) >= m.Idle {
+					final = completeLines(data[:seen])
+				}
+				arrived = now
+			} else if now.Sub(arrived) >= m.Idle {
+				final = completeLines(data)
+			}
+			seen = len(data)
+		}
+		if final > 0 {
+			advance, token = m.split(data[:final], true)
+			final -= advance
+		} else {
+			advance, token = m.split(data, atEOF)
+		}
+		seen -= advance
+		if seen < 0 {
+			seen = 0
+		}
+		return advance, token, nil
+	}
+}
+
+// completeLines returns the length of the complete lines at the start of data.
+func completeLines(data []byte) int {
+	return bytes.LastIndexByte(data, '\n') + 1
+}
+
+// joins reports whether line is part of the record before it.
+func (m Multiline) joins(line []byte) bool {
+	if m.Start != nil && m.Start.Match(line) {
+		return false
+	}
+	if m.Continue != nil {
+		return m.Continue.Match(line)
+	}
+	return m.Start != nil
+}
+
+// split finds the record at the start of data.
+func (m Multiline) split(data []byte, atEOF bool) (int, []byte) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		if atEOF {
+			return len(data), dropCR(data)
+		}
+		return 0, nil
+	}
+	record := append([]byte{}, dropCR(data[:end])...)
+	lines := 1
+	pos := end + 1
+	continued := m.Continued != nil && m.Continued.Match(record)
+	for m.MaxLines <= 0 || lines < m.MaxLines {
+		next := bytes.IndexByte(data[pos:], '\n')
+		lineEnd := pos + next + 1
+		if next < 0 {
+			if !atEOF {
+				// we can't tell if the record is finished yet
+				return 0, nil
+			}
+			if pos == len(data) {
+				break
+			}
+			next = len(data) - pos
+			lineEnd = len(data)
+		}
+		line := dropCR(data[pos : pos+next])
+		if !continued && !m.joins(line) {
+			break
+		}
+		if m.MaxBytes > 0 && len(record)+1+len(line) > m.MaxBytes {
+			break
+		}
+		record = append(append(record, '\n'), line...)
+		lines++
+		pos = lineEnd
+		continued = m.Continued != nil && m.Continued.Match(line)
+	}
+	return pos, record
+}
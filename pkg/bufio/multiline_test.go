@@ -0,0 +1,127 @@
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+package bufio
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// splitAll runs a split function over all of input, as a Scanner would at EOF.
+func splitAll(t *testing.T, split SplitFunc, input string) []string {
+	data := []byte(input)
+	tokens := []string{}
+	for {
+		advance, token, err := split(data, true)
+		require.NoError(t, err)
+		if advance == 0 && token == nil {
+			return tokens
+		}
+		if token != nil {
+			tokens = append(tokens, string(token))
+		}
+		data = data[advance:]
+	}
+}
+
+const javaTrace = "2020-01-02 10:00:00 ERROR boom\r\n" +
+	"java.lang.IllegalStateException: bad\n" +
+	"\tat com.example.Foo.bar(Foo.java:10)\n" +
+	"\tat com.example.Main.main(Main.java:5)\n" +
+	"2020-01-02 10:00:01 INFO fine\n"
+
+func TestMultiline(t *testing.T) {
+	tests := []struct {
+		name  string
+		m     Multiline
+		input string
+		want  []string
+	}{
+		{"like ScanLines", Multiline{}, "a\r\nb\n\nc", []string{"a", "b", "", "c"}},
+		{"start", Multiline{Start: regexp.MustCompile(`^\d{4}-`)}, javaTrace, []string{
+			"2020-01-02 10:00:00 ERROR boom\njava.lang.IllegalStateException: bad\n\tat com.example.Foo.bar(Foo.java:10)\n\tat com.example.Main.main(Main.java:5)",
+			"2020-01-02 10:00:01 INFO fine",
+		}},
+		{"continue", Multiline{Continue: regexp.MustCompile(`^\s`)}, javaTrace, []string{
+			"2020-01-02 10:00:00 ERROR boom",
+			"java.lang.IllegalStateException: bad\n\tat com.example.Foo.bar(Foo.java:10)\n\tat com.example.Main.main(Main.java:5)",
+			"2020-01-02 10:00:01 INFO fine",
+		}},
+		{"start and continue", Multiline{Start: regexp.MustCompile(`^\d{4}-`), Continue: regexp.MustCompile(`^(\s|java\.)`)},
+			javaTrace + "stray\n", []string{
+				"2020-01-02 10:00:00 ERROR boom\njava.lang.IllegalStateException: bad\n\tat com.example.Foo.bar(Foo.java:10)\n\tat com.example.Main.main(Main.java:5)",
+				"2020-01-02 10:00:01 INFO fine",
+				"stray",
+			}},
+		{"backslash", Multiline{Continued: regexp.MustCompile(`\\$`)}, "a \\\nb \\\nc\nd\n", []string{"a \\\nb \\\nc", "d"}},
+		{"max lines", Multiline{Continue: regexp.MustCompile(`^ `), MaxLines: 2}, "a\n b\n c\n d\ne", []string{"a\n b", " c\n d", "e"}},
+		{"max bytes", Multiline{Continue: regexp.MustCompile(`^ `), MaxBytes: 6}, "a\n b\n c\n d\n", []string{"a\n b", " c\n d"}},
+		{"first line over max bytes", Multiline{Continue: regexp.MustCompile(`^ `), MaxBytes: 2}, "abcdef\n g\n", []string{"abcdef", " g"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitAll(t, tt.m.SplitFunc(), tt.input))
+		})
+	}
+}
+
+func TestMultilineWaitsForNextLine(t *testing.T) {
+	split := Multiline{Continue: regexp.MustCompile(`^\s`)}.SplitFunc()
+	advance, token, err := split([]byte("a\n b\n"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, advance)
+	assert.Nil(t, token)
+
+	advance, token, err = split([]byte("a\n b\nc\n"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, advance)
+	assert.Equal(t, "a\n b", string(token))
+}
+
+func TestMultilineIdle(t *testing.T) {
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	m := Multiline{
+		Continue: regexp.MustCompile(`^\s`),
+		Idle:     time.Second,
+		Clock:    func() time.Time { return now },
+	}
+
+	// nothing new for a while: the complete lines are flushed
+	split := m.SplitFunc()
+	advance, token, _ := split([]byte("a\n b\n c"), false)
+	assert.Equal(t, 0, advance)
+	assert.Nil(t, token)
+	now = now.Add(time.Second)
+	advance, token, _ = split([]byte("a\n b\n c"), false)
+	assert.Equal(t, 5, advance)
+	assert.Equal(t, "a\n b", string(token))
+	advance, token, _ = split([]byte(" c"), false)
+	assert.Equal(t, 0, advance)
+	assert.Nil(t, token)
+
+	// new data after a while: it doesn't join what came before
+	split = m.SplitFunc()
+	advance, token, _ = split([]byte("a\n b\n"), false)
+	assert.Equal(t, 0, advance)
+	assert.Nil(t, token)
+	now = now.Add(2 * time.Second)
+	data := []byte("a\n b\n c\nd\n")
+	advance, token, _ = split(data, false)
+	assert.Equal(t, 5, advance)
+	assert.Equal(t, "a\n b", string(token))
+	data = data[advance:]
+	advance, token, _ = split(data, false)
+	assert.Equal(t, 3, advance)
+	assert.Equal(t, " c", string(token))
+}
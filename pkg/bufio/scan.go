@@ -17,6 +17,7 @@
 //   (won't cause excessive zero-byte Read()s) when no new data is ready on the ring buffer
 // - Copy maxConsecutiveEmptyReads constant from https://golang.org/src/bufio/bufio.go
 // - Remove all scannera methods that we don't use
+// - Add Flush, to get tokens out of a partial buffer without waiting for EOF
 
 package bufio
 
@@ -234,6 +235,33 @@ func (s *Scanner) Scan() bool {
 	}
 }
 
+// Flush is like Scan, except that it doesn't read any more data. It calls the
+// split function on the data the Scanner is already holding as if the reader
+// were at EOF, so that a partial token is returned rather than waited for.
+// It returns false when nothing more can be made of that data, or on error.
+// Afterwards, Scan carries on reading as usual.
+func (s *Scanner) Flush() bool {
+	if s.err != nil {
+		return false
+	}
+	for s.end > s.start {
+		advance, token, err := s.split(s.buf[s.start:s.end], true)
+		if err != nil {
+			s.setErr(err)
+			return false
+		}
+		if advance == 0 || !s.advance(advance) {
+			// without progress, we'd keep returning the same token
+			return false
+		}
+		if token != nil {
+			s.token = token
+			return true
+		}
+	}
+	return false
+}
+
 // advance consumes n bytes of the buffer. It reports whether the advance was legal.
 func (s *Scanner) advance(n int) bool {
 	if n < 0 {
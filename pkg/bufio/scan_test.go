@@ -0,0 +1,52 @@
+// ----- ---- --- -- -
+// Copyright 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+package bufio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pendingReader hands out whatever has been added to it, like a ring buffer
+// that is still being written to.
+type pendingReader struct {
+	data []byte
+}
+
+func (r *pendingReader) ScannerRead(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, ErrNoNewData
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestScannerFlush(t *testing.T) {
+	r := &pendingReader{}
+	s := NewScanner(r, ScanLines)
+	assert.False(t, s.Flush())
+
+	r.data = []byte("one\npass")
+	assert.True(t, s.Scan())
+	assert.Equal(t, "one", string(s.Bytes()))
+	assert.False(t, s.Scan())
+
+	// the partial line is only returned when we ask for it
+	assert.True(t, s.Flush())
+	assert.Equal(t, "pass", string(s.Bytes()))
+	assert.False(t, s.Flush())
+	assert.Nil(t, s.Err())
+
+	r.data = []byte("word\n")
+	assert.True(t, s.Scan())
+	assert.Equal(t, "word", string(s.Bytes()))
+}
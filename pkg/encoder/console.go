@@ -0,0 +1,220 @@
+package encoder
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageKeys are the keys that Console looks in, in order, for the text of a
+// record's message. The filter interpreters use msg for parsed messages, _msg for
+// text that JSONSplit wrapped up, _txt for lines RedisInterpreter couldn't parse,
+// and _other for whatever LastChanceInterpreter found left over. Only the first one
+// present is shown as the message; any others are shown with the rest of the fields.
+var MessageKeys = []string{"msg", "_msg", "_txt", "_other"}
+
+// ANSI escape sequences used by Console
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+	ansiGray    = "\x1b[90m"
+)
+
+// Console is an Encoder meant for people rather than programs. It writes each
+// record on a line of the form
+//
+//	timestamp level [module] message key=value key=value ...
+//
+// leaving out any part the record doesn't have. If the message runs over several
+// lines, the rest of it is written below, indented.
+//
+// Console remembers the widest module it has seen so that, with Align set, the
+// messages line up; because of that, use a pointer to it, and don't share one
+// between outputs that should be aligned independently.
+type Console struct {
+	// Color turns on ANSI colors: levels are colored by severity, and keys are
+	// highlighted.
+	Color bool
+	// Align pads the level and module to a constant width, and the message to
+	// MessageWidth, so that the columns line up from one record to the next.
+	Align bool
+	// MessageWidth is the width the first line of the message is padded to
+	// when Align is set and there are fields after it.
+	MessageWidth int
+	// MaxValueLen, if positive, truncates each field value (but not the
+	// message) to that many characters, marking the truncation with an ellipsis.
+	MaxValueLen int
+	// TimeFormat, if set, is the layout used to reformat timestamps that are
+	// time.Time or RFC3339 strings; anything else is written as it is.
+	TimeFormat string
+
+	mutex       sync.Mutex
+	moduleWidth int
+}
+
+var _ Encoder = (*Console)(nil)
+
+// Encode implements Encoder for Console
+func (c *Console) Encode(w io.Writer, fields map[string]interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	buf := &bytes.Buffer{}
+	used := map[string]bool{}
+	col := func(s string) {
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(s)
+	}
+
+	if ts, ok := fields["timestamp"]; ok {
+		used["timestamp"] = true
+		col(c.paint(ansiGray, c.timestamp(ts)))
+	}
+
+	// only keys that are in the record are marked as used, so that comparing the
+	// counts tells us whether there are other fields to come
+	level, hasLevel := fields["level"]
+	if hasLevel || c.Align {
+		if hasLevel {
+			used["level"] = true
+		}
+		name := strings.ToUpper(String(level))
+		if c.Align {
+			name = pad(name, 5)
+		}
+		col(c.paint(levelColor(String(level)), name))
+	}
+
+	if module, ok := fields["module"]; ok || c.Align {
+		m := ""
+		if ok {
+			used["module"] = true
+			m = "[" + String(module) + "]"
+		}
+		if c.Align {
+			if n := utf8.RuneCountInString(m); n > c.moduleWidth {
+				c.moduleWidth = n
+			}
+			m = pad(m, c.moduleWidth)
+		}
+		if m != "" {
+			col(m)
+		}
+	}
+
+	var rest []string
+	for _, k := range MessageKeys {
+		if v, ok := fields[k]; ok {
+			used[k] = true
+			lines := strings.Split(strings.TrimRight(String(v), "\n"), "\n")
+			msg := lines[0]
+			rest = lines[1:]
+			if c.Align && c.MessageWidth > 0 && len(fields) > len(used) {
+				msg = pad(msg, c.MessageWidth)
+			}
+			col(c.paint(ansiBold, msg))
+			break
+		}
+	}
+
+	for _, k := range Keys(fields) {
+		if used[k] {
+			continue
+		}
+		v := fields[k]
+		if c.MaxValueLen > 0 && v != nil {
+			// truncate before quoting, so that the quotes stay balanced
+			v = truncate(String(v), c.MaxValueLen)
+		}
+		col(c.paint(ansiCyan, LogfmtKey(k)+"=") + LogfmtValue(v))
+	}
+
+	// trailing spaces from padding are of no use to anyone
+	line := bytes.TrimRight(buf.Bytes(), " ")
+	buf = bytes.NewBuffer(line)
+	buf.WriteByte('\n')
+	for _, l := range rest {
+		buf.WriteString("    ")
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// paint wraps s in the given color if colors are turned on.
+func (c *Console) paint(color, s string) string {
+	if !c.Color || color == "" || s == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+func (c *Console) timestamp(v interface{}) string {
+	if c.TimeFormat == "" {
+		return String(v)
+	}
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(c.TimeFormat)
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return parsed.Format(c.TimeFormat)
+		}
+	}
+	return String(v)
+}
+
+// levelColor chooses the color for a level, recognizing the common spellings.
+func levelColor(level string) string {
+	switch strings.ToLower(level) {
+	case "trace", "debug":
+		return ansiGray
+	case "info", "notice":
+		return ansiGreen
+	case "warn", "warning":
+		return ansiYellow
+	case "error", "err":
+		return ansiRed
+	case "fatal", "panic", "crit", "critical", "alert", "emerg":
+		return ansiBold + ansiMagenta
+	}
+	return ""
+}
+
+// pad right-pads s with spaces to width characters.
+func pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// truncate shortens s to max characters, the last of which is an ellipsis.
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:max-1]) + "…"
+}
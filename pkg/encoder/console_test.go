@@ -0,0 +1,97 @@
+package encoder
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsolePlain(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := &Console{}
+	require.NoError(t, c.Encode(buf, sampleRecord()))
+	assert.Equal(t, `2019-04-18T15:18:28.565Z INFO [consensus] hello <world> _msg="raw message" alpha=true height=5 zeta=last`+"\n", buf.String())
+}
+
+func TestConsoleMessageKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		want   string
+	}{
+		{"redis", map[string]interface{}{"_txt": "raw redis line", "pid": "12"}, "raw redis line pid=12\n"},
+		{"last chance", map[string]interface{}{"_other": "leftovers"}, "leftovers\n"},
+		{"tendermint", map[string]interface{}{"_msg": "Executed block", "level": "info", "module": "state", "height": 2},
+			"INFO [state] Executed block height=2\n"},
+		{"multiline", map[string]interface{}{"_msg": "Block{\n  Header{\n  }\n}", "level": "debug"},
+			"DEBUG Block{\n      Header{\n      }\n    }\n"},
+		{"nothing", map[string]interface{}{"a": 1}, "a=1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			require.NoError(t, (&Console{}).Encode(buf, tt.fields))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestConsoleAlign(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := &Console{Align: true, MessageWidth: 12}
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"level": "info", "module": "p2p", "msg": "Send", "a": 1}))
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"level": "error", "module": "consensus", "msg": "Oops"}))
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"level": "warn", "module": "p2p", "msg": "Receive", "b": 2}))
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"msg": "bare"}))
+	// no level or module, but still a field after the message
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"msg": "hi", "a": 1}))
+	assert.Equal(t, ""+
+		"INFO  [p2p] Send         a=1\n"+
+		"ERROR [consensus] Oops\n"+
+		"WARN  [p2p]       Receive      b=2\n"+
+		"                  bare\n"+
+		"                  hi           a=1\n",
+		buf.String())
+}
+
+func TestConsoleColor(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := &Console{Color: true}
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"level": "error", "msg": "bad", "k": "v"}))
+	assert.Equal(t, "\x1b[31mERROR\x1b[0m \x1b[1mbad\x1b[0m \x1b[36mk=\x1b[0mv\n", buf.String())
+}
+
+func TestConsoleTruncate(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := &Console{MaxValueLen: 8}
+	require.NoError(t, c.Encode(buf, map[string]interface{}{
+		"msg":   "the message itself is never truncated",
+		"long":  "0123456789abcdef",
+		"short": "fits",
+		"words": "hello there world",
+	}))
+	// the value is truncated before it is quoted
+	assert.Equal(t, "the message itself is never truncated long=0123456… short=fits words=\"hello t…\"\n", buf.String())
+}
+
+func TestConsoleTimeFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := &Console{TimeFormat: "15:04:05.000"}
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"timestamp": "2019-04-18T15:18:28.565Z", "msg": "a"}))
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"timestamp": time.Date(2019, 4, 18, 1, 2, 3, 0, time.UTC), "msg": "b"}))
+	require.NoError(t, c.Encode(buf, map[string]interface{}{"timestamp": "yesterday", "msg": "c"}))
+	assert.Equal(t, "15:18:28.565 a\n01:02:03.000 b\nyesterday c\n", buf.String())
+}
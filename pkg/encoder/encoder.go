@@ -0,0 +1,240 @@
+package encoder
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encoder writes a single record, of the kind produced by a filter.Filter, to w.
+// Every encoder in this package writes the keys of a record in the same order
+// every time: see Keys.
+type Encoder interface {
+	Encode(w io.Writer, fields map[string]interface{}) error
+}
+
+// WellKnownKeys are the keys that are written first, in this order, whenever
+// they are present in a record. All other keys follow in sorted order.
+var WellKnownKeys = []string{"timestamp", "level", "module", "msg", "_msg"}
+
+// Keys returns the keys of fields in the order encoders write them: the
+// WellKnownKeys that are present, followed by the rest in sorted order.
+func Keys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	known := make(map[string]bool, len(WellKnownKeys))
+	for _, k := range WellKnownKeys {
+		if _, ok := fields[k]; ok && !known[k] {
+			keys = append(keys, k)
+		}
+		known[k] = true
+	}
+	rest := len(keys)
+	for k := range fields {
+		if !known[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys[rest:])
+	return keys
+}
+
+// JSON is an Encoder that writes each record as a JSON object followed by a newline.
+// In compact mode (the default) each record is a single line; if Pretty is set, the
+// object is indented over several lines.
+//
+// Values that can't be represented in JSON (functions, channels, NaNs, things whose
+// MarshalJSON fails, and so on) are written as strings instead of failing the record.
+type JSON struct {
+	Pretty bool
+}
+
+var _ Encoder = JSON{}
+
+// Encode implements Encoder for JSON
+func (j JSON) Encode(w io.Writer, fields map[string]interface{}) error {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for n, k := range Keys(fields) {
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(marshalSafe(fields[k]))
+	}
+	buf.WriteByte('}')
+
+	out := buf.Bytes()
+	if j.Pretty {
+		pretty := &bytes.Buffer{}
+		if err := json.Indent(pretty, out, "", "  "); err != nil {
+			return err
+		}
+		out = pretty.Bytes()
+	}
+	out = append(out, '\n')
+	_, err := w.Write(out)
+	return err
+}
+
+// Logfmt is an Encoder that writes each record as space-separated key=value pairs
+// on a single line. Values are quoted whenever they are empty or contain spaces,
+// quotes, equals signs or control characters; maps and slices are written as JSON.
+//
+// If Pretty is set, each record is written over several lines instead: the
+// well-known keys on the first line and every other pair on a line of its own,
+// indented, so that long records are easier to read.
+type Logfmt struct {
+	Pretty bool
+}
+
+var _ Encoder = Logfmt{}
+
+// Encode implements Encoder for Logfmt
+func (l Logfmt) Encode(w io.Writer, fields map[string]interface{}) error {
+	buf := &bytes.Buffer{}
+	known := make(map[string]bool, len(WellKnownKeys))
+	for _, k := range WellKnownKeys {
+		known[k] = true
+	}
+	first := true
+	for _, k := range Keys(fields) {
+		switch {
+		case first:
+		case l.Pretty && !known[k]:
+			buf.WriteString("\n  ")
+		default:
+			buf.WriteByte(' ')
+		}
+		first = false
+		buf.WriteString(LogfmtKey(k))
+		buf.WriteByte('=')
+		buf.WriteString(LogfmtValue(fields[k]))
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// LogfmtKey makes k safe to use as a logfmt key by replacing anything that
+// would break parsing with an underscore.
+func LogfmtKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if needsQuote(r) {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+// LogfmtValue formats a single value for logfmt, quoting it if it wouldn't
+// otherwise survive being split on spaces and equals signs.
+func LogfmtValue(v interface{}) string {
+	s := String(v)
+	if v == nil {
+		return s
+	}
+	if s == "" || strings.IndexFunc(s, needsQuote) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func needsQuote(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+}
+
+// String renders a single value as plain text. Strings are returned as they are,
+// times are formatted as RFC3339Nano, maps and slices are rendered as compact JSON,
+// and anything else uses its String or Error method or fmt's default formatting.
+// A nil value is the empty string.
+func String(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case json.Number:
+		return x.String()
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case error:
+		return x.Error()
+	case fmt.Stringer:
+		return x.String()
+	case map[string]interface{}, []interface{}:
+		return string(marshalSafe(x))
+	}
+	return fmt.Sprint(v)
+}
+
+// marshal is json.Marshal without the HTML escaping, which only makes logs
+// harder to read.
+func marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// marshalSafe marshals v, falling back to a string representation of any part of
+// it that can't be represented in JSON.
+func marshalSafe(v interface{}) []byte {
+	b, err := marshal(v)
+	if err == nil {
+		return b
+	}
+	b, err = marshal(sanitize(v))
+	if err != nil {
+		// this really shouldn't happen, since sanitize only produces JSON-able things
+		b, _ = marshal(fmt.Sprint(v))
+	}
+	return b
+}
+
+// sanitize replaces anything that can't be marshaled with its string representation,
+// descending into maps and slices so that only the offending parts are replaced.
+func sanitize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, vv := range x {
+			out[k] = sanitize(vv)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, vv := range x {
+			out[i] = sanitize(vv)
+		}
+		return out
+	}
+	if _, err := marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return v
+}
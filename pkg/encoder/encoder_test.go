@@ -0,0 +1,158 @@
+package encoder
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleRecord() map[string]interface{} {
+	return map[string]interface{}{
+		"zeta":      "last",
+		"height":    5,
+		"_msg":      "raw message",
+		"msg":       "hello <world>",
+		"module":    "consensus",
+		"level":     "info",
+		"timestamp": "2019-04-18T15:18:28.565Z",
+		"alpha":     true,
+	}
+}
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		want   []string
+	}{
+		{"empty", map[string]interface{}{}, []string{}},
+		{"no well-known", map[string]interface{}{"b": 1, "a": 2, "c": 3}, []string{"a", "b", "c"}},
+		{"all", sampleRecord(), []string{"timestamp", "level", "module", "msg", "_msg", "alpha", "height", "zeta"}},
+		{"some", map[string]interface{}{"b": 1, "_msg": 2, "level": 3}, []string{"level", "_msg", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Keys(tt.fields))
+		})
+	}
+}
+
+func TestKeysStable(t *testing.T) {
+	want := Keys(sampleRecord())
+	for i := 0; i < 100; i++ {
+		require.Equal(t, want, Keys(sampleRecord()))
+	}
+}
+
+func TestJSONCompact(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, JSON{}.Encode(buf, sampleRecord()))
+	assert.Equal(t, `{"timestamp":"2019-04-18T15:18:28.565Z","level":"info","module":"consensus","msg":"hello <world>","_msg":"raw message","alpha":true,"height":5,"zeta":"last"}`+"\n", buf.String())
+
+	// and it's still valid JSON
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.Equal(t, 8, len(m))
+}
+
+func TestJSONPretty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, JSON{Pretty: true}.Encode(buf, map[string]interface{}{
+		"b":     map[string]interface{}{"y": 1, "x": 2},
+		"level": "warn",
+	}))
+	assert.Equal(t, `{
+  "level": "warn",
+  "b": {
+    "x": 2,
+    "y": 1
+  }
+}
+`, buf.String())
+}
+
+func TestJSONUnencodable(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, JSON{}.Encode(buf, map[string]interface{}{
+		"nan":    math.NaN(),
+		"nested": map[string]interface{}{"ok": 1, "inf": math.Inf(1)},
+		"list":   []interface{}{"fine", complex(1, 2)},
+		"number": json.Number("123456789012345678901234567890"),
+	}))
+	assert.Equal(t, `{"list":["fine","(1+2i)"],"nan":"NaN","nested":{"inf":"+Inf","ok":1},"number":123456789012345678901234567890}`+"\n", buf.String())
+
+	// a function's representation is an address, so just check that it became a string
+	buf.Reset()
+	require.NoError(t, JSON{}.Encode(buf, map[string]interface{}{"fn": func() {}}))
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.IsType(t, "", m["fn"])
+}
+
+func TestLogfmt(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, Logfmt{}.Encode(buf, sampleRecord()))
+	assert.Equal(t, `timestamp=2019-04-18T15:18:28.565Z level=info module=consensus msg="hello <world>" _msg="raw message" alpha=true height=5 zeta=last`+"\n", buf.String())
+}
+
+func TestLogfmtPretty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, Logfmt{Pretty: true}.Encode(buf, sampleRecord()))
+	assert.Equal(t, `timestamp=2019-04-18T15:18:28.565Z level=info module=consensus msg="hello <world>" _msg="raw message"
+  alpha=true
+  height=5
+  zeta=last
+`, buf.String())
+}
+
+func TestLogfmtValues(t *testing.T) {
+	when := time.Date(2019, 4, 18, 15, 18, 28, 565000000, time.UTC)
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"empty", "", `""`},
+		{"plain", "abc", "abc"},
+		{"space", "a b", `"a b"`},
+		{"equals", "a=b", `"a=b"`},
+		{"quote", `say "hi"`, `"say \"hi\""`},
+		{"newline", "a\nb", `"a\nb"`},
+		{"int", 42, "42"},
+		{"float", 1.5, "1.5"},
+		{"bool", false, "false"},
+		{"time", when, "2019-04-18T15:18:28.565Z"},
+		{"error", errors.New("bad thing"), `"bad thing"`},
+		{"number", json.Number("9007199254740993"), "9007199254740993"},
+		{"map", map[string]interface{}{"a": 1}, `"{\"a\":1}"`},
+		{"slice", []interface{}{1, 2}, "[1,2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, LogfmtValue(tt.v))
+		})
+	}
+}
+
+func TestLogfmtKey(t *testing.T) {
+	assert.Equal(t, "plain", LogfmtKey("plain"))
+	assert.Equal(t, "a_b_c_d", LogfmtKey("a b=c\"d"))
+	assert.Equal(t, "_", LogfmtKey(""))
+}
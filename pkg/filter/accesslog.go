@@ -0,0 +1,158 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats for AccessLogInterpreter, written as nginx log_format strings
+const (
+	// CommonLogFormat is the Common Log Format
+	CommonLogFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`
+	// CombinedLogFormat is the Combined Log Format, which is also nginx's default
+	CombinedLogFormat = CommonLogFormat + ` "$http_referer" "$http_user_agent"`
+)
+
+// AccessLogInterpreter parses HTTP access logs written in a format described
+// by an nginx log_format string, like CombinedLogFormat:
+// 127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/" "Mozilla/4.08"
+//
+// The well-known variables are stored under these fields:
+//
+//	remote_addr                  remote_addr
+//	remote_user                  user
+//	time_local, time_iso8601     timestamp (in RFC3339Nano)
+//	request                      method, path and protocol
+//	status                       status (an int)
+//	body_bytes_sent, bytes_sent  bytes (an int)
+//	request_length               request_length (an int)
+//	http_referer                 referer
+//	http_user_agent              user_agent
+//	request_time                 request_time (a float64, in seconds)
+//	upstream_response_time       upstream_response_time (a float64, in seconds)
+//
+// Any other variable is stored as a string under its own name. A value of "-"
+// means that there is no value, so it is left out, and so is any number that
+// won't parse. A request that isn't made of the usual three parts is stored
+// as it is, in request.
+//
+// If the data matches the format it is consumed; otherwise it is passed on
+// unchanged. Merge controls what happens to fields that are already in the record.
+type AccessLogInterpreter struct {
+	Merge Merge
+
+	pattern *regexp.Regexp
+	vars    []string
+}
+
+var _ Interpreter = AccessLogInterpreter{}
+
+// logFormatVarPat matches the variables in an nginx log_format string
+var logFormatVarPat = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+
+// NewAccessLogInterpreter constructs an AccessLogInterpreter for a log format,
+// which is given in the syntax of nginx's log_format directive. It returns an
+// error if the format has no variables, or if one is used twice.
+func NewAccessLogInterpreter(format string) (AccessLogInterpreter, error) {
+	i := AccessLogInterpreter{}
+	var pat strings.Builder
+	pat.WriteString("^")
+	seen := map[string]bool{}
+	last := 0
+	for _, loc := range logFormatVarPat.FindAllStringSubmatchIndex(format, -1) {
+		name := ""
+		if loc[2] >= 0 {
+			name = format[loc[2]:loc[3]]
+		} else {
+			name = format[loc[4]:loc[5]]
+		}
+		if seen[name] {
+			return i, fmt.Errorf("variable $%s appears more than once in log format", name)
+		}
+		seen[name] = true
+		pat.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		pat.WriteString("(.*?)")
+		i.vars = append(i.vars, name)
+		last = loc[1]
+	}
+	if len(i.vars) == 0 {
+		return i, errors.New("log format has no variables")
+	}
+	pat.WriteString(regexp.QuoteMeta(format[last:]))
+	pat.WriteString("$")
+	var err error
+	i.pattern, err = regexp.Compile(pat.String())
+	return i, err
+}
+
+// Interpret implements Interpreter for AccessLogInterpreter
+func (i AccessLogInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	if i.pattern == nil {
+		return data, fields
+	}
+	matches := i.pattern.FindStringSubmatch(strings.TrimRight(string(data), "\r\n"))
+	if matches == nil {
+		return data, fields
+	}
+	found := map[string]interface{}{}
+	for n, name := range i.vars {
+		v := matches[n+1]
+		if v == "-" || v == "" {
+			continue
+		}
+		switch name {
+		case "remote_user":
+			found["user"] = v
+		case "time_local":
+			if t, err := time.Parse("02/Jan/2006:15:04:05 -0700", v); err == nil {
+				found["timestamp"] = t.Format(time.RFC3339Nano)
+			}
+		case "time_iso8601":
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				found["timestamp"] = t.Format(time.RFC3339Nano)
+			}
+		case "request":
+			if parts := strings.Split(v, " "); len(parts) == 3 {
+				found["method"] = parts[0]
+				found["path"] = parts[1]
+				found["protocol"] = parts[2]
+			} else {
+				found["request"] = v
+			}
+		case "status", "request_length":
+			if n, err := strconv.Atoi(v); err == nil {
+				found[name] = n
+			}
+		case "body_bytes_sent", "bytes_sent":
+			if n, err := strconv.Atoi(v); err == nil {
+				found["bytes"] = n
+			}
+		case "request_time", "upstream_response_time":
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				found[name] = f
+			}
+		case "http_referer":
+			found["referer"] = v
+		case "http_user_agent":
+			found["user_agent"] = v
+		default:
+			found[name] = v
+		}
+	}
+	return nil, i.Merge.Apply(fields, found)
+}
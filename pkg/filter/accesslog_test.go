@@ -0,0 +1,82 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogInterpreter(t *testing.T) {
+	const nginxTimed = `$remote_addr - $remote_user [$time_iso8601] "$request" $status $bytes_sent ` +
+		`"$http_referer" "$http_user_agent" rt=$request_time uct="${upstream_connect_time}"`
+	tests := []struct {
+		name     string
+		format   string
+		input    string
+		wantData string
+		want     map[string]interface{}
+	}{
+		{"common", CommonLogFormat, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326` + "\n", "",
+			map[string]interface{}{
+				"remote_addr": "127.0.0.1", "user": "frank", "timestamp": "2000-10-10T13:55:36-07:00",
+				"method": "GET", "path": "/apache_pb.gif", "protocol": "HTTP/1.0", "status": 200, "bytes": 2326,
+			}},
+		{"common no user or bytes", CommonLogFormat, `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "GET / HTTP/1.1" 304 -`, "",
+			map[string]interface{}{
+				"remote_addr": "10.0.0.1", "timestamp": "2000-10-10T13:55:36Z",
+				"method": "GET", "path": "/", "protocol": "HTTP/1.1", "status": 304,
+			}},
+		{"combined", CombinedLogFormat,
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`, "",
+			map[string]interface{}{
+				"remote_addr": "127.0.0.1", "user": "frank", "timestamp": "2000-10-10T13:55:36-07:00",
+				"method": "GET", "path": "/apache_pb.gif", "protocol": "HTTP/1.0", "status": 200, "bytes": 2326,
+				"referer": "http://www.example.com/start.html", "user_agent": "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			}},
+		{"bad request", CombinedLogFormat, `1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "\x16\x03\x01" 400 150 "-" "-"`, "",
+			map[string]interface{}{
+				"remote_addr": "1.2.3.4", "timestamp": "2000-10-10T13:55:36-07:00",
+				"request": `\x16\x03\x01`, "status": 400, "bytes": 150,
+			}},
+		{"nginx", nginxTimed,
+			`::1 - - [2020-03-04T05:06:07+00:00] "POST /tx HTTP/2.0" 202 17 "-" "curl/7.64.1" rt=0.013 uct="0.000"`, "",
+			map[string]interface{}{
+				"remote_addr": "::1", "timestamp": "2020-03-04T05:06:07Z",
+				"method": "POST", "path": "/tx", "protocol": "HTTP/2.0", "status": 202, "bytes": 17,
+				"user_agent": "curl/7.64.1", "request_time": 0.013, "upstream_connect_time": "0.000",
+			}},
+		{"no match", CombinedLogFormat, "hello world", "hello world", map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := NewAccessLogInterpreter(tt.format)
+			require.NoError(t, err)
+			data, fields := i.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Equal(t, tt.wantData, string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestAccessLogInterpreterBadFormat(t *testing.T) {
+	_, err := NewAccessLogInterpreter("no variables here")
+	assert.Error(t, err)
+	_, err = NewAccessLogInterpreter("$status $status")
+	assert.Error(t, err)
+
+	// the zero value doesn't match anything
+	data, fields := AccessLogInterpreter{}.Interpret([]byte("x"), map[string]interface{}{})
+	assert.Equal(t, "x", string(data))
+	assert.Empty(t, fields)
+}
@@ -0,0 +1,163 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConsensusInterpreter follows Tendermint's consensus state machine through the
+// messages it logs as it enters each step, like
+// "enterPrevote(5/0). Current: 5/0/RoundStepPropose", and adds fields that
+// describe where consensus has got to and how long it took to get there.
+// Put it after the interpreters that extract the message, such as JSONInterpreter
+// or TendermintTextInterpreter.
+//
+// Every record for a step gets a step field with the name of the step. Once a
+// height has had more than one step, each record also gets prev_step with the
+// step just left and prev_step_duration (and prev_step_duration_ns) with the time
+// spent in it. The first record for a new height also summarizes the height before
+// it: completed_height, height_duration (and height_duration_ns), height_rounds,
+// and step_durations_ns, an object giving the total time spent in each step.
+//
+// Times come from the record's TimeKey field (a time.Time, or a string in
+// RFC3339 format) if it has one, and otherwise from Clock. Messages for heights
+// older than the current one are left alone.
+//
+// A ConsensusInterpreter keeps state between records, so it must be used as a
+// pointer, and each one should only see the logs of a single node.
+// Merge controls what happens to fields that are already in the record.
+type ConsensusInterpreter struct {
+	Keys    []string
+	TimeKey string
+	Clock   func() time.Time
+	Merge   Merge
+
+	mutex       sync.Mutex
+	height      int
+	rounds      int
+	step        string
+	stepStart   time.Time
+	heightStart time.Time
+	durations   map[string]time.Duration
+}
+
+var _ Interpreter = (*ConsensusInterpreter)(nil)
+
+// NewConsensusInterpreter constructs a ConsensusInterpreter that looks for
+// messages in msg and _msg, takes times from timestamp, and otherwise uses the
+// system clock.
+func NewConsensusInterpreter() *ConsensusInterpreter {
+	return &ConsensusInterpreter{
+		Keys:    []string{"msg", "_msg"},
+		TimeKey: "timestamp",
+		Clock:   time.Now,
+	}
+}
+
+// consensusStepPat matches the messages Tendermint logs when it enters a step.
+// When it refuses to enter one, it logs "enterPropose(5/0): Invalid args. Current
+// step: ...", which has a colon instead of the ". Current:" and must not match.
+var consensusStepPat = regexp.MustCompile(`\benter([A-Za-z]+)\((\d+)/(\d+)\)\. Current:`)
+
+// Interpret implements Interpreter for ConsensusInterpreter
+func (i *ConsensusInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	var matches []string
+	for _, k := range i.Keys {
+		if s, ok := fields[k].(string); ok {
+			if matches = consensusStepPat.FindStringSubmatch(s); matches != nil {
+				break
+			}
+		}
+	}
+	if matches == nil {
+		return data, fields
+	}
+	step := matches[1]
+	height, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return data, fields
+	}
+	round, err := strconv.Atoi(matches[3])
+	if err != nil {
+		return data, fields
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if height < i.height {
+		return data, fields
+	}
+	now := i.now(fields)
+	found := map[string]interface{}{"step": step}
+
+	if height > i.height {
+		if i.height != 0 {
+			i.leaveStep(now)
+			elapsed := now.Sub(i.heightStart)
+			steps := map[string]interface{}{}
+			for s, d := range i.durations {
+				steps[s] = d.Nanoseconds()
+			}
+			found["completed_height"] = i.height
+			found["height_duration"] = elapsed.String()
+			found["height_duration_ns"] = elapsed.Nanoseconds()
+			found["height_rounds"] = i.rounds
+			found["step_durations_ns"] = steps
+		}
+		i.height = height
+		i.heightStart = now
+		i.rounds = 0
+		i.durations = map[string]time.Duration{}
+	} else {
+		elapsed := i.leaveStep(now)
+		found["prev_step"] = i.step
+		found["prev_step_duration"] = elapsed.String()
+		found["prev_step_duration_ns"] = elapsed.Nanoseconds()
+	}
+
+	i.step = step
+	i.stepStart = now
+	if round+1 > i.rounds {
+		i.rounds = round + 1
+	}
+	return data, i.Merge.Apply(fields, found)
+}
+
+// leaveStep adds the time spent in the current step to its total, and returns it.
+// It must be called with the mutex held.
+func (i *ConsensusInterpreter) leaveStep(now time.Time) time.Duration {
+	elapsed := now.Sub(i.stepStart)
+	i.durations[i.step] += elapsed
+	return elapsed
+}
+
+// now returns the time of the record.
+func (i *ConsensusInterpreter) now(fields map[string]interface{}) time.Time {
+	if i.TimeKey != "" {
+		switch t := fields[i.TimeKey].(type) {
+		case time.Time:
+			return t
+		case string:
+			if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				return parsed
+			}
+		}
+	}
+	if i.Clock != nil {
+		return i.Clock()
+	}
+	return time.Now()
+}
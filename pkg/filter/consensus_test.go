@@ -0,0 +1,109 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsensusInterpreterTimeline(t *testing.T) {
+	base := time.Date(2019, 4, 27, 1, 13, 43, 0, time.UTC)
+	now := base
+	i := NewConsensusInterpreter()
+	i.Clock = func() time.Time { return now }
+
+	steps := []struct {
+		after time.Duration
+		msg   string
+		want  map[string]interface{}
+	}{
+		{0, "enterNewRound(2/0). Current: 2/0/RoundStepNewHeight", map[string]interface{}{
+			"step": "NewRound",
+		}},
+		{100 * time.Millisecond, "enterPropose(2/0). Current: 2/0/RoundStepNewRound", map[string]interface{}{
+			"step": "Propose", "prev_step": "NewRound",
+			"prev_step_duration": "100ms", "prev_step_duration_ns": int64(100000000),
+		}},
+		{0, "Received proposal", map[string]interface{}{}},
+		// a rejected transition isn't a step
+		{0, "enterNewRound(2/0): Invalid args. Current step: 2/0/RoundStepPropose", map[string]interface{}{}},
+		{time.Second, "enterPrevote(2/0). Current: 2/0/RoundStepPropose", map[string]interface{}{
+			"step": "Prevote", "prev_step": "Propose",
+			"prev_step_duration": "1s", "prev_step_duration_ns": int64(1000000000),
+		}},
+		{50 * time.Millisecond, "enterPropose(2/0): Invalid args. Current step: 2/0/RoundStepPrevote", map[string]interface{}{}},
+		{150 * time.Millisecond, "enterNewRound(2/1). Current: 2/0/RoundStepPrevote", map[string]interface{}{
+			"step": "NewRound", "prev_step": "Prevote",
+			"prev_step_duration": "200ms", "prev_step_duration_ns": int64(200000000),
+		}},
+		{100 * time.Millisecond, "enterCommit(2/1). Current: 2/1/RoundStepNewRound", map[string]interface{}{
+			"step": "Commit", "prev_step": "NewRound",
+			"prev_step_duration": "100ms", "prev_step_duration_ns": int64(100000000),
+		}},
+		{0, "enterPrevote(1/0). Current: 2/1/RoundStepCommit", map[string]interface{}{}},
+		{time.Second, "enterNewRound(3/0). Current: 3/0/RoundStepNewHeight", map[string]interface{}{
+			"step":               "NewRound",
+			"completed_height":   2,
+			"height_duration":    "2.4s",
+			"height_duration_ns": int64(2400000000),
+			"height_rounds":      2,
+			"step_durations_ns": map[string]interface{}{
+				"NewRound": int64(200000000),
+				"Propose":  int64(1000000000),
+				"Prevote":  int64(200000000),
+				"Commit":   int64(1000000000),
+			},
+		}},
+	}
+	for _, s := range steps {
+		now = now.Add(s.after)
+		fields := map[string]interface{}{"_msg": s.msg}
+		data, got := i.Interpret([]byte("x"), fields)
+		assert.Equal(t, "x", string(data))
+		delete(got, "_msg")
+		assert.Equal(t, s.want, got, s.msg)
+	}
+}
+
+func TestConsensusInterpreterTimestamps(t *testing.T) {
+	i := NewConsensusInterpreter()
+	i.Clock = func() time.Time { panic("the clock shouldn't be used") }
+	chain := []Interpreter{TendermintTextInterpreter{}, i}
+	lines := []string{
+		"I[2019-04-18|15:18:28.000] enterNewRound(5/0). Current: 5/0/RoundStepNewHeight module=consensus height=5 round=0",
+		"I[2019-04-18|15:18:28.250] enterPropose(5/0). Current: 5/0/RoundStepNewRound module=consensus height=5 round=0",
+	}
+	var fields map[string]interface{}
+	for _, line := range lines {
+		data := []byte(line)
+		fields = map[string]interface{}{}
+		for _, terp := range chain {
+			data, fields = terp.Interpret(data, fields)
+		}
+	}
+	assert.Equal(t, "Propose", fields["step"])
+	assert.Equal(t, "NewRound", fields["prev_step"])
+	assert.Equal(t, "250ms", fields["prev_step_duration"])
+	assert.Equal(t, 5, fields["height"])
+}
+
+func TestConsensusInterpreterMerge(t *testing.T) {
+	i := NewConsensusInterpreter()
+	i.Merge = Merge{Policy: Nest, Key: "consensus"}
+	_, fields := i.Interpret(nil, map[string]interface{}{"msg": "enterNewRound(1/0). Current: 1/0/RoundStepNewHeight", "step": "x"})
+	assert.Equal(t, map[string]interface{}{
+		"msg": "enterNewRound(1/0). Current: 1/0/RoundStepNewHeight", "step": "x",
+		"consensus": map[string]interface{}{"step": "NewRound"},
+	}, fields)
+}
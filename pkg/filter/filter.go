@@ -11,7 +11,10 @@ package filter
 
 
 import (
+	"context"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/ndau/writers/pkg/bufio"
 	"github.com/ndau/writers/pkg/ringbuffer"
@@ -21,60 +24,448 @@ import (
 // or os.Stderr.
 // It assumes that its input is a stream of JSON objects. At initialization, it accepts a number
 // of Interpreters. On each call to Write(), it filters the input data through each Interpreter
-// in order, and then writes the result (a map of k/v pairs) to its output function.
+// in order, and then writes the result (a map of k/v pairs) to its output Sink.
 // Because we can't guarantee that calls to Write map neatly to JSON objects, we use a
 // RingBuffer to allow a scanner to retrieve JSON objects independent of the way
 // the Write calls work.
+//
+// Several sources can feed the same Filter by way of Writer(); each gets its own
+// ring buffer and scanner, and their records are merged into the one stream sent
+// to the Sink in the order their data arrived; see Writer.
+//
+// When the process is finished, call Close() to flush any data still sitting in the
+// buffer through the interpreters to the output, and to close the Sink.
 type Filter struct {
 	Interpreters []Interpreter
-	cbuf         *ringbuffer.RingBuffer
+	newSplitter  func() bufio.SplitFunc
+	sink         Sink
+	done         chan struct{}
+	ctx          context.Context
+	mode         ShutdownMode
+	limit        int
+	policy       ringbuffer.OverflowPolicy
+	idle         time.Duration
+	newTimer     func(d time.Duration) (<-chan time.Time, func() bool) // faked in tests
+	closing      chan struct{}
+	closeOnce    sync.Once
+	finished     chan struct{}
+	err          error
+
+	// arrivalMutex protects arrivals, the list of which input each write went to,
+	// in the order they happened; arrived is signalled whenever it grows
+	arrivalMutex sync.Mutex
+	arrivals     []arrival
+	arrived      chan struct{}
+
+	// mutex protects everything below
+	mutex    sync.Mutex
+	main     *input
+	tagged   map[string]*input
+	inputs   []*input
+	stopping bool
 }
 
-// static assert that Filter implements Writer
-var _ io.Writer = (*Filter)(nil)
+// static assert that Filter implements WriteCloser
+var _ io.WriteCloser = (*Filter)(nil)
+
+// SourceKey is the field that records get tagged with to say which of the Filter's
+// writers they came from. Records written to the Filter itself don't have it.
+const SourceKey = "source"
+
+// New accepts a SplitFunc, an output function, and some options and constructs a Filter.
+// It is the same as NewWithSink with the output function wrapped in an OutputFunc.
+func New(splitter bufio.SplitFunc, output func(map[string]interface{}), opts ...Option) *Filter {
+	return NewWithSink(splitter, OutputFunc(output), opts...)
+}
+
+// NewWithSink accepts a SplitFunc, a Sink, and some options and constructs a Filter.
+// It spawns a goroutine that uses the splitter to read tokens from the ring buffer,
+// calls interpreters on the token, and emits the result to the sink.
+// The goroutine runs until Close() is called, or until it is stopped by a done channel
+// or context supplied as an option; either way, the sink is closed when it exits.
+func NewWithSink(splitter bufio.SplitFunc, sink Sink, opts ...Option) *Filter {
+	fp := &Filter{
+		newSplitter: func() bufio.SplitFunc { return splitter },
+		sink:        sink,
+		ctx:         context.Background(),
+		closing:     make(chan struct{}),
+		finished:    make(chan struct{}),
+		arrived:     make(chan struct{}, 1),
+		newTimer:    newTimer,
+		tagged:      make(map[string]*input),
+	}
+	for _, opt := range opts {
+		opt(fp)
+	}
+
+	fp.main = fp.newInput("")
+	go fp.run()
+
+	return fp
+}
 
 // NewFilter accepts a SplitFunc, an output function, and some interpreters and constructs a Filter.
 // It spawns a goroutine that uses the splitter to read tokens from the ring buffer,
 // and then calls interpreters on the token.
 // It accepts a done channel (which may be nil), which will shut down its goroutine when closed.
 func NewFilter(splitter bufio.SplitFunc, output func(map[string]interface{}), done chan struct{}, terps ...Interpreter) *Filter {
-	fp := &Filter{
-		Interpreters: terps,
-		cbuf:         ringbuffer.New(4096),
+	return New(splitter, output, WithDone(done), WithInterpreters(terps...))
+}
+
+// Write implements io.Writer on the Filter. It just forwards the writes
+// to its ring buffer.
+func (f *Filter) Write(b []byte) (int, error) {
+	return f.main.cbuf.Write(b)
+}
+
+// Writer returns an io.Writer for one source of data feeding this Filter, such as
+// one of a process's output streams. Every record made from data written to it is
+// tagged with the field SourceKey set to tag. Each source is split separately, so
+// a partial token from one can't get mixed up with the data from another, but all
+// of them go through the same interpreters to the same sink.
+//
+// A single goroutine scans every source, a write at a time in the order the writes
+// happened, so records reach the sink in the order the data that finished them
+// was written, whichever source it came from. Each source gets a splitter of its
+// own if the Filter was given WithSplitterFactory; otherwise they all share the
+// one passed to New, which mustn't be one that keeps state, like those made by
+// bufio.Multiline or GoPanicSplit.
+//
+// Calling Writer again with the same tag returns the same writer. Once the Filter
+// is shutting down, the writers it returns fail every Write with io.EOF.
+func (f *Filter) Writer(tag string) io.Writer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if in, ok := f.tagged[tag]; ok {
+		return in.cbuf
 	}
+	if f.stopping {
+		// nothing will ever read it, so hand back a buffer that's already closed
+		cbuf := ringbuffer.New(0)
+		cbuf.Close()
+		return cbuf
+	}
+	in := f.newInputLocked(tag)
+	f.tagged[tag] = in
+	return in.cbuf
+}
+
+// Close implements io.Closer on the Filter. It stops accepting writes, lets the
+// splitter see the end of the data so that any partial token is delivered, sends
+// every remaining record to the sink, and then waits for the Filter's
+// goroutine to exit. It is safe to call Close more than once.
+//
+// If the done channel was closed or the context was cancelled in DropPending mode first,
+// the goroutine has already stopped and anything left in the buffers is discarded.
+// Close returns the same error as Wait.
+func (f *Filter) Close() error {
+	f.stop()
+	f.closeOnce.Do(func() {
+		close(f.closing)
+	})
+	return f.Wait()
+}
+
+// Wait blocks until the Filter's goroutine has exited and its sink has been closed,
+// and returns the error that ended it, if any. That is the first error reported by a
+// scanner or the sink, or the context's error if the context was cancelled in
+// DropPending mode. Otherwise, a Filter that was shut down by Close, by its done
+// channel, or by cancellation in DrainPending mode returns nil.
+func (f *Filter) Wait() error {
+	<-f.finished
+	return f.err
+}
+
+// newInput starts a new source of data.
+func (f *Filter) newInput(tag string) *input {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.newInputLocked(tag)
+}
+
+// newInputLocked starts a new source of data. It must be called with the mutex held.
+func (f *Filter) newInputLocked(tag string) *input {
+	in := &input{
+		tag:  tag,
+		cbuf: ringbuffer.New(4096),
+	}
+	in.cbuf.SetLimit(f.limit, f.policy)
+	in.cbuf.SetNotify(func(written, dropped int) {
+		f.arrive(in, written, dropped)
+	})
+	in.scanner = bufio.NewScanner(in, f.newSplitter())
+	f.inputs = append(f.inputs, in)
+	return in
+}
+
+// arrive records that data has been written to an input, or thrown away because
+// its ring buffer was full. It is called by the input's ring buffer with the
+// buffer locked, so the arrivals are in the same order as the writes.
+func (f *Filter) arrive(in *input, written, dropped int) {
+	f.arrivalMutex.Lock()
+	last := len(f.arrivals) - 1
+	switch {
+	case last >= 0 && f.arrivals[last].in == in && dropped > 0:
+		// the drop comes after anything already recorded
+		f.arrivals[last].dropped += dropped
+		f.arrivals[last].drops++
+	case last >= 0 && f.arrivals[last].in == in && f.arrivals[last].drops == 0:
+		f.arrivals[last].n += written
+	case dropped > 0:
+		f.arrivals = append(f.arrivals, arrival{in: in, dropped: dropped, drops: 1})
+	default:
+		f.arrivals = append(f.arrivals, arrival{in: in, n: written})
+	}
+	f.arrivalMutex.Unlock()
+	select {
+	case f.arrived <- struct{}{}:
+	default:
+	}
+}
 
-	go func() {
-		scanner := bufio.NewScanner(fp.cbuf, splitter)
+// stop makes the Filter stop accepting writes, and stops any more inputs from
+// being started. It can be called any number of times.
+func (f *Filter) stop() {
+	f.mutex.Lock()
+	f.stopping = true
+	inputs := f.inputs
+	f.mutex.Unlock()
 
-		for {
-			select {
-			case <-done:
-				// just shut down
+	for _, in := range inputs {
+		in.close()
+	}
+}
+
+// run is the body of the Filter's goroutine. It scans each input as data arrives
+// for it, and exits when done is closed, when the context is cancelled in
+// DropPending mode, or when the Filter is closed or the context cancelled in
+// DrainPending mode and everything written has been scanned. If there is an idle
+// timeout, it flushes the scanners when nothing has arrived for that long.
+func (f *Filter) run() {
+	defer f.finish()
+	cancelled := f.ctx.Done()
+	var idle <-chan time.Time
+	stopTimer := func() bool { return false }
+	defer func() {
+		stopTimer()
+	}()
+
+	for {
+		select {
+		case <-idle:
+			idle = nil
+			for _, in := range f.snapshot() {
+				f.flush(in)
+			}
+			f.setErr(f.sink.Flush())
+		case <-f.done:
+			// just shut down, but don't leave anyone blocked in Write
+			f.stop()
+			return
+		case <-cancelled:
+			f.stop()
+			if f.mode == DropPending {
+				f.setErr(f.ctx.Err())
 				return
-			case <-fp.cbuf.C:
-				for scanner.Scan() {
-					data := scanner.Bytes()
-					fields := map[string]interface{}{}
-					for _, i := range fp.Interpreters {
-						data, fields = i.Interpret(data, fields)
-					}
-					output(fields)
-				}
-				// if the scanner fails, emit a standard message to the output
-				if err := scanner.Err(); err != nil {
-					output(map[string]interface{}{"module": "filter", "level": "error", "error": err.Error()})
-				}
+			}
+			f.drain()
+			return
+		case <-f.closing:
+			f.drain()
+			return
+		case <-f.arrived:
+			f.scanArrivals()
+			f.setErr(f.sink.Flush())
+			if f.idle > 0 {
+				// start the wait over with a new timer, so an old one can't fire
+				stopTimer()
+				idle, stopTimer = f.newTimer(f.idle)
 			}
 		}
-	}()
+	}
+}
 
-	return fp
+// newTimer starts a timer for the idle timeout. It returns the channel the time is
+// sent on when it fires, and a function that stops it.
+func newTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
 }
 
-// Write implements io.Writer on the Filter. It just forwards the writes
-// to its ring buffer.
-func (f *Filter) Write(b []byte) (int, error) {
-	return f.cbuf.Write(b)
+// finish is called as the Filter's goroutine exits. It makes sure nothing more can
+// be written, flushes and closes the sink, and releases anyone waiting.
+func (f *Filter) finish() {
+	f.stop()
+	f.setErr(f.sink.Flush())
+	f.setErr(f.sink.Close())
+	close(f.finished)
+}
+
+// snapshot returns the Filter's inputs, in the order they were started.
+func (f *Filter) snapshot() []*input {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.inputs
+}
+
+// drain scans everything that was written before the Filter stopped accepting
+// writes, all the way to the end of each input so that partial tokens are
+// delivered. The inputs must already be closed.
+func (f *Filter) drain() {
+	f.scanArrivals()
+	for _, in := range f.snapshot() {
+		if f.abandoned() {
+			return
+		}
+		f.scan(in)
+	}
+	f.setErr(f.sink.Flush())
+}
+
+// scanArrivals scans the inputs in the order data arrived for them, letting each
+// one's scanner read only as far as the data that had arrived by then, until
+// there is nothing more to read. Data that was dropped is reported at the point
+// it was dropped, after the tokens made from the data written before it.
+func (f *Filter) scanArrivals() {
+	for {
+		f.arrivalMutex.Lock()
+		arrivals := f.arrivals
+		f.arrivals = nil
+		f.arrivalMutex.Unlock()
+		if len(arrivals) == 0 {
+			return
+		}
+		for _, a := range arrivals {
+			if f.abandoned() {
+				return
+			}
+			a.in.allowed += a.n
+			f.scan(a.in)
+			if a.drops > 0 {
+				f.reportDropped(a)
+			}
+		}
+	}
+}
+
+// scan reads every token currently available from an input's scanner and sends
+// each one through the interpreters to the sink.
+func (f *Filter) scan(in *input) {
+	for in.scanner.Scan() {
+		if f.abandoned() {
+			return
+		}
+		f.process(in, in.scanner.Bytes())
+	}
+	// if the scanner fails, emit a standard message to the sink
+	if err := in.scanner.Err(); err != nil {
+		f.setErr(err)
+		f.emit(in, map[string]interface{}{"module": "filter", "level": "error", "error": err.Error()})
+	}
+}
+
+// flush sends whatever partial tokens an input's scanner is holding through the
+// interpreters to the sink.
+func (f *Filter) flush(in *input) {
+	for in.scanner.Flush() {
+		if f.abandoned() {
+			return
+		}
+		f.process(in, in.scanner.Bytes())
+	}
+	if err := in.scanner.Err(); err != nil {
+		f.setErr(err)
+		f.emit(in, map[string]interface{}{"module": "filter", "level": "error", "error": err.Error()})
+	}
+}
+
+// process runs a single token through the interpreters and emits the result.
+func (f *Filter) process(in *input, data []byte) {
+	fields := map[string]interface{}{}
+	for _, i := range f.Interpreters {
+		data, fields = i.Interpret(data, fields)
+	}
+	f.emit(in, fields)
+}
+
+// emit sends a record to the sink, tagging it with its source.
+func (f *Filter) emit(in *input, fields map[string]interface{}) {
+	if in.tag != "" {
+		fields[SourceKey] = in.tag
+	}
+	f.setErr(f.sink.Emit(fields))
+}
+
+// setErr records the first error the Filter encounters.
+// Only the Filter's goroutine may call it.
+func (f *Filter) setErr(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// reportDropped emits a standard message to the sink saying how much data an
+// input's ring buffer threw away.
+func (f *Filter) reportDropped(a arrival) {
+	f.emit(a.in, map[string]interface{}{
+		"module":         "filter",
+		"level":          "warn",
+		"msg":            "buffer full; data dropped",
+		"dropped":        a.dropped,
+		"dropped_writes": a.drops,
+	})
+}
+
+// abandoned reports whether the Filter has been told to stop without processing
+// the rest of its input.
+func (f *Filter) abandoned() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+	}
+	return f.mode == DropPending && f.ctx.Err() != nil
+}
+
+// input is one source of data for a Filter: a ring buffer, and a scanner that
+// reads from it.
+type input struct {
+	tag       string
+	cbuf      *ringbuffer.RingBuffer
+	scanner   *bufio.Scanner
+	allowed   int // how much the scanner may read; only the Filter's goroutine uses it
+	closeOnce sync.Once
+}
+
+var _ bufio.ScannerReader = (*input)(nil)
+
+// ScannerRead implements bufio.ScannerReader for input. It reads from the ring
+// buffer, but no further than the data that scanArrivals has got to, so that a
+// token finished by a later write isn't emitted ahead of earlier writes to
+// other inputs.
+func (in *input) ScannerRead(p []byte) (int, error) {
+	if len(p) > in.allowed {
+		p = p[:in.allowed]
+	}
+	n, err := in.cbuf.ScannerRead(p)
+	in.allowed -= n
+	return n, err
+}
+
+// close stops further writes to the ring buffer; it can be called any number of times.
+func (in *input) close() {
+	in.closeOnce.Do(func() {
+		in.cbuf.Close()
+	})
+}
+
+// arrival records that n bytes were written to an input, and then that dropped
+// bytes were thrown away by drops writes.
+type arrival struct {
+	in      *input
+	n       int
+	dropped int
+	drops   int
 }
 
 // NewJSONFilter is a convenience function to construct a Filter that uses a JSON splitter,
@@ -11,8 +11,11 @@ package filter
 
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -20,6 +23,7 @@ import (
 	"github.com/ndau/writers/pkg/bufio"
 	"github.com/ndau/writers/pkg/ringbuffer"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // This demonstrates how to use a RingBuffer with a JSONSplit object and a scanner
@@ -251,3 +255,414 @@ func TestTendermintJSON(t *testing.T) {
 	assert.Equal(t, 1, count)
 	mut.Unlock()
 }
+
+func TestFilterClose(t *testing.T) {
+	// no mutex needed; Close guarantees the goroutine is gone before we look
+	ma := make([]map[string]interface{}, 0)
+	outputter := func(m map[string]interface{}) {
+		ma = append(ma, m)
+	}
+
+	filter := NewJSONFilter(outputter, nil, JSONInterpreter{})
+	for i := 0; i < 10; i++ {
+		filter.Write(buildJSON(5))
+	}
+	// a partial object and some trailing text that only the EOF can finish
+	filter.Write([]byte(`{"a": 1, "b": `))
+	err := filter.Close()
+	assert.Nil(t, err)
+
+	assert.Equal(t, 11, len(ma))
+	for n := 0; n < 10; n++ {
+		assert.Equal(t, 5, len(ma[n]))
+	}
+	assert.Equal(t, `{"a": 1, "b": `, ma[10]["_msg"])
+
+	// writes after Close fail, and closing again is harmless
+	_, err = filter.Write([]byte(`{"a": 1}`))
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, filter.Close())
+	assert.Equal(t, 11, len(ma))
+}
+
+func TestLineFilterCloseUnterminated(t *testing.T) {
+	ma := make([]map[string]interface{}, 0)
+	outputter := func(m map[string]interface{}) {
+		ma = append(ma, m)
+	}
+
+	filter := NewLineFilter(outputter, nil, LastChanceInterpreter{})
+	filter.Write([]byte("one\ntwo\nthree"))
+	assert.Nil(t, filter.Close())
+
+	assert.Equal(t, 3, len(ma))
+	assert.Equal(t, "three", ma[2]["_other"])
+}
+
+func TestFilterCloseAfterDone(t *testing.T) {
+	done := make(chan struct{})
+	filter := NewJSONFilter(func(map[string]interface{}) {}, done, JSONInterpreter{})
+	close(done)
+	// this must not block even though the goroutine was already told to stop
+	assert.Nil(t, filter.Close())
+}
+
+func TestFilterContextDrain(t *testing.T) {
+	ma := make([]map[string]interface{}, 0)
+	outputter := func(m map[string]interface{}) {
+		ma = append(ma, m)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	filter := New(JSONSplit, outputter,
+		WithContext(ctx, DrainPending),
+		WithInterpreters(JSONInterpreter{}),
+	)
+	for i := 0; i < 10; i++ {
+		filter.Write(buildJSON(5))
+	}
+	filter.Write([]byte(`unfinished business`))
+	cancel()
+
+	assert.Nil(t, filter.Wait())
+	assert.Equal(t, 11, len(ma))
+	assert.Equal(t, "unfinished business", ma[10]["_msg"])
+	_, err := filter.Write(buildJSON(5))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFilterContextDrop(t *testing.T) {
+	stuck := make(chan struct{})
+	release := make(chan struct{})
+	count := 0
+	outputter := func(m map[string]interface{}) {
+		// hold up the pipeline on the first record so the rest are still pending
+		if count == 0 {
+			close(stuck)
+			<-release
+		}
+		count++
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	filter := New(JSONSplit, outputter,
+		WithContext(ctx, DropPending),
+		WithInterpreters(JSONInterpreter{}),
+	)
+	for i := 0; i < 10; i++ {
+		filter.Write(buildJSON(5))
+	}
+	// wait for the goroutine to get stuck in the output function
+	<-stuck
+	cancel()
+	close(release)
+
+	assert.Equal(t, context.Canceled, filter.Wait())
+	assert.Equal(t, 1, count)
+	// Close after the fact reports the same thing and doesn't block
+	assert.Equal(t, context.Canceled, filter.Close())
+}
+
+func TestFilterWaitScannerError(t *testing.T) {
+	var errors []interface{}
+	outputter := func(m map[string]interface{}) {
+		if e, ok := m["error"]; ok {
+			errors = append(errors, e)
+		}
+	}
+
+	filter := New(bufio.ScanLines, outputter)
+	// one line longer than the scanner will ever hold
+	filter.Write(make([]byte, bufio.MaxScanTokenSize+1))
+	assert.Equal(t, bufio.ErrTooLong, filter.Close())
+	assert.NotEmpty(t, errors)
+}
+
+func TestFilterBufferLimitDrops(t *testing.T) {
+	stuck := make(chan struct{})
+	release := make(chan struct{})
+	ma := make([]map[string]interface{}, 0)
+	outputter := func(m map[string]interface{}) {
+		// hold up the pipeline on the first record so the buffer fills up
+		if len(ma) == 0 {
+			close(stuck)
+			<-release
+		}
+		ma = append(ma, m)
+	}
+
+	filter := New(bufio.ScanLines, outputter,
+		WithBufferLimit(20, ringbuffer.DropNewest),
+		WithInterpreters(LastChanceInterpreter{}),
+	)
+	filter.Write([]byte("first\n"))
+	// once the first line is in the output function, the buffer is empty
+	<-stuck
+	filter.Write([]byte("second\n"))
+	filter.Write([]byte("third\n"))
+	filter.Write([]byte("this one won't fit\n"))
+	filter.Write([]byte("last\n"))
+	close(release)
+	assert.Nil(t, filter.Close())
+
+	// the drop is reported after the lines that were written before it, and
+	// before those written after it
+	assert.Equal(t, 5, len(ma))
+	assert.Equal(t, "first", ma[0]["_other"])
+	assert.Equal(t, "second", ma[1]["_other"])
+	assert.Equal(t, "third", ma[2]["_other"])
+	assert.Equal(t, "filter", ma[3]["module"])
+	assert.Equal(t, 19, ma[3]["dropped"])
+	assert.Equal(t, 1, ma[3]["dropped_writes"])
+	assert.Equal(t, "last", ma[4]["_other"])
+}
+
+func TestFilterBufferLimitBlockReleasedByDone(t *testing.T) {
+	done := make(chan struct{})
+	stuck := make(chan struct{})
+	var once sync.Once
+	outputter := func(map[string]interface{}) {
+		once.Do(func() { close(stuck) })
+		<-done
+	}
+	filter := New(bufio.ScanLines, outputter,
+		WithDone(done),
+		WithBufferLimit(10, ringbuffer.Block),
+	)
+	result := make(chan error)
+	go func() {
+		var err error
+		for err == nil {
+			_, err = filter.Write([]byte("line\n"))
+		}
+		result <- err
+	}()
+	// once nothing is being read and the buffer is full, the writer has to block
+	<-stuck
+	require.Eventually(t, func() bool { return filter.main.cbuf.Len() == 10 }, 5*time.Second, time.Millisecond)
+	close(done)
+	assert.Equal(t, io.EOF, <-result)
+}
+
+// withTimer makes the Filter's idle timer fire whenever something is sent on c,
+// instead of after the timeout.
+func withTimer(c <-chan time.Time) Option {
+	return func(f *Filter) {
+		f.newTimer = func(time.Duration) (<-chan time.Time, func() bool) {
+			return c, func() bool { return true }
+		}
+	}
+}
+
+func TestFilterIdleTimeout(t *testing.T) {
+	records := make(chan map[string]interface{}, 10)
+	outputter := func(m map[string]interface{}) {
+		records <- m
+	}
+
+	idle := make(chan time.Time)
+	filter := New(bufio.ScanLines, outputter,
+		WithInterpreters(LastChanceInterpreter{}),
+		WithIdleTimeout(time.Hour),
+		withTimer(idle),
+	)
+	// a prompt never gets its newline, so it has to be flushed; the send is
+	// only received once the prompt has been scanned
+	filter.Write([]byte("Enter password: "))
+	idle <- time.Time{}
+	assert.Equal(t, "Enter password: ", (<-records)["_other"])
+
+	// after that, lines are scanned as usual
+	filter.Write([]byte("one\ntw"))
+	filter.Write([]byte("o\n"))
+	assert.Nil(t, filter.Close())
+	close(records)
+	ma := []map[string]interface{}{}
+	for m := range records {
+		ma = append(ma, m)
+	}
+	assert.Equal(t, 2, len(ma))
+	assert.Equal(t, "one", ma[0]["_other"])
+	assert.Equal(t, "two", ma[1]["_other"])
+}
+
+func TestFilterIdleTimer(t *testing.T) {
+	records := make(chan map[string]interface{}, 10)
+	filter := New(bufio.ScanLines, func(m map[string]interface{}) { records <- m },
+		WithInterpreters(LastChanceInterpreter{}),
+		WithIdleTimeout(time.Millisecond),
+	)
+	// this waits for as long as the timer takes, however long that is
+	filter.Write([]byte("Enter password: "))
+	assert.Equal(t, "Enter password: ", (<-records)["_other"])
+	assert.Nil(t, filter.Close())
+}
+
+func TestFilterWriters(t *testing.T) {
+	ma := make([]map[string]interface{}, 0)
+	outputter := func(m map[string]interface{}) {
+		ma = append(ma, m)
+	}
+
+	filter := New(JSONSplit, outputter, WithInterpreters(JSONInterpreter{}))
+	stdout := filter.Writer("stdout")
+	stderr := filter.Writer("stderr")
+	assert.Equal(t, stdout, filter.Writer("stdout"))
+
+	// interleave a JSON object on stdout with an unterminated line on stderr;
+	// neither should corrupt the other
+	stdout.Write([]byte(`{"a":`))
+	stderr.Write([]byte(`partial line with a { brace`))
+	time.Sleep(20 * time.Millisecond)
+	stdout.Write([]byte(`1}`))
+	filter.Write([]byte(`{"b":2}`))
+	assert.Nil(t, filter.Close())
+
+	assert.Equal(t, 3, len(ma))
+	bySource := map[interface{}]map[string]interface{}{}
+	for _, m := range ma {
+		bySource[m[SourceKey]] = m
+	}
+	assert.Equal(t, map[string]interface{}{"a": 1.0, SourceKey: "stdout"}, bySource["stdout"])
+	assert.Equal(t, map[string]interface{}{"_msg": "partial line with a { brace", SourceKey: "stderr"}, bySource["stderr"])
+	assert.Equal(t, map[string]interface{}{"b": 2.0}, bySource[nil])
+
+	// the filter is closed, so new and old writers alike refuse writes
+	_, err := filter.Writer("late").Write([]byte(`{"c":3}`))
+	assert.Equal(t, io.EOF, err)
+	_, err = stdout.Write([]byte(`{"c":3}`))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFilterWritersOrderWithinSource(t *testing.T) {
+	seen := map[interface{}][]string{}
+	outputter := func(m map[string]interface{}) {
+		tag := m[SourceKey]
+		seen[tag] = append(seen[tag], m["_other"].(string))
+	}
+
+	filter := New(bufio.ScanLines, outputter, WithInterpreters(LastChanceInterpreter{}))
+	want := []string{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 200; i++ {
+		want = append(want, strconv.Itoa(i))
+	}
+	for _, tag := range []string{"stdout", "stderr"} {
+		wg.Add(1)
+		go func(w io.Writer) {
+			defer wg.Done()
+			for _, line := range want {
+				w.Write([]byte(line + "\n"))
+			}
+		}(filter.Writer(tag))
+	}
+	wg.Wait()
+	assert.Nil(t, filter.Close())
+	// the sources are interleaved, but each one is in the order it was written
+	assert.Equal(t, want, seen["stdout"])
+	assert.Equal(t, want, seen["stderr"])
+}
+
+func TestFilterWritersOrderAcrossSources(t *testing.T) {
+	stuck := make(chan struct{})
+	release := make(chan struct{})
+	got := []string{}
+	outputter := func(m map[string]interface{}) {
+		// hold up the pipeline on the first record so the rest pile up behind it
+		if len(got) == 0 {
+			close(stuck)
+			<-release
+		}
+		got = append(got, fmt.Sprint(m[SourceKey], ":", m["_other"]))
+	}
+
+	filter := New(bufio.ScanLines, outputter, WithInterpreters(LastChanceInterpreter{}))
+	stdout := filter.Writer("stdout")
+	stderr := filter.Writer("stderr")
+	stdout.Write([]byte("1\n"))
+	<-stuck
+	stdout.Write([]byte("2\n"))
+	stderr.Write([]byte("3\n"))
+	stdout.Write([]byte("4\n5"))
+	filter.Write([]byte("6\n"))
+	stderr.Write([]byte("7\n"))
+	// the stdout line that was started before 6 and 7 is finished after them
+	stdout.Write([]byte("\n"))
+	close(release)
+	assert.Nil(t, filter.Close())
+
+	assert.Equal(t, []string{
+		"stdout:1",
+		"stdout:2",
+		"stderr:3",
+		"stdout:4",
+		"<nil>:6",
+		"stderr:7",
+		"stdout:5",
+	}, got)
+}
+
+func TestFilterSplitterFactory(t *testing.T) {
+	ma := make([]map[string]interface{}, 0)
+	outputter := func(m map[string]interface{}) {
+		ma = append(ma, m)
+	}
+
+	made := 0
+	factory := func() bufio.SplitFunc {
+		made++
+		return GoPanicSplit(bufio.ScanLines)
+	}
+	filter := New(nil, outputter,
+		WithSplitterFactory(factory),
+		WithInterpreters(GoPanicInterpreter{}, LastChanceInterpreter{}),
+	)
+	stdout := filter.Writer("stdout")
+	stderr := filter.Writer("stderr")
+	assert.Equal(t, 3, made)
+
+	// a panic on stderr, with ordinary lines on stdout in the middle of it; each
+	// splitter keeps track of its own source
+	stderr.Write([]byte("panic: oops\n\ngoroutine 1 [running]:\n"))
+	stdout.Write([]byte("one\n"))
+	stderr.Write([]byte("main.main()\n\t/app/main.go:5 +0x20\n"))
+	stdout.Write([]byte("two\n"))
+	stderr.Write([]byte("exit status 2\n"))
+	assert.Nil(t, filter.Close())
+
+	others := []interface{}{}
+	panics := 0
+	for _, m := range ma {
+		if m[SourceKey] == "stdout" {
+			others = append(others, m["_other"])
+		} else if _, ok := m["panic"]; ok {
+			panics++
+		}
+	}
+	assert.Equal(t, []interface{}{"one", "two"}, others)
+	assert.Equal(t, 1, panics)
+}
+
+func TestFilterWritersConcurrent(t *testing.T) {
+	count := map[interface{}]int{}
+	outputter := func(m map[string]interface{}) {
+		// the filter serializes calls to the output, so no mutex is needed
+		count[m[SourceKey]]++
+	}
+
+	filter := New(bufio.ScanLines, outputter, WithInterpreters(LastChanceInterpreter{}))
+	wg := sync.WaitGroup{}
+	for _, tag := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(w io.Writer) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.Write([]byte("li"))
+				w.Write([]byte("ne\n"))
+			}
+		}(filter.Writer(tag))
+	}
+	wg.Wait()
+	assert.Nil(t, filter.Close())
+	assert.Equal(t, map[interface{}]int{"a": 100, "b": 100, "c": 100}, count)
+}
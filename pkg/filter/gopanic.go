@@ -0,0 +1,257 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ndau/writers/pkg/bufio"
+)
+
+// goPanicStartPat matches the line that starts a Go panic or goroutine dump
+var goPanicStartPat = regexp.MustCompile(`(?m)^(?:panic: |fatal error: |SIGQUIT: quit|goroutine \d+ \[[^\]]*\]:\r?$)`)
+
+// goroutinePat matches the header of one goroutine's stack in a dump
+var goroutinePat = regexp.MustCompile(`^goroutine (\d+) \[([^\]]*)\]:$`)
+
+// goFramePat matches the line naming the function of a stack frame
+var goFramePat = regexp.MustCompile(`^[^\s(]+\(.*\)$`)
+
+// goFileLinePat matches the line giving the file and line number of a stack frame
+var goFileLinePat = regexp.MustCompile(`^\t(.+):(\d+)(?: \+0x[0-9a-f]+)?$`)
+
+// goPanicMaxHeader is how many lines a panic may have before its first goroutine
+// before we stop treating it as a panic; the message can be more than one line.
+const goPanicMaxHeader = 20
+
+// DefaultGoPanicMaxBytes is the most GoPanicSplit puts in one token. It is well
+// short of bufio.MaxScanTokenSize, which would stop the scanner for good.
+const DefaultGoPanicMaxBytes = 32 * 1024
+
+// GoPanicSplit returns a split function that recognizes Go panics and goroutine
+// dumps, which start with a line like "panic: ...", "fatal error: ...", or
+// "goroutine 1 [running]:", and returns each one as a single token. All other data
+// is split by inner. A dump ends at the first line that doesn't look like part of
+// one, or at the end of the data. Use GoPanicInterpreter to make sense of the tokens.
+//
+// A dump longer than DefaultGoPanicMaxBytes, like that of a process with
+// thousands of goroutines, is returned in pieces, split between goroutines
+// where possible. The split function keeps track of how much of the data it has
+// looked at, so each Scanner needs one of its own.
+func GoPanicSplit(inner bufio.SplitFunc) bufio.SplitFunc {
+	return GoPanicSplitLimit(inner, DefaultGoPanicMaxBytes)
+}
+
+// GoPanicSplitLimit is GoPanicSplit with a limit of maxBytes on the size of each
+// piece of a dump; zero means no limit.
+func GoPanicSplitLimit(inner bufio.SplitFunc, maxBytes int) bufio.SplitFunc {
+	// searched is how much of the data is known not to contain the start of a
+	// dump, and dump is how far we got through the dump at the start of the data
+	searched := 0
+	dump := goPanicScan{}
+
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		defer func() {
+			if advance > 0 {
+				dump = goPanicScan{}
+				searched -= advance
+				if searched < 0 {
+					searched = 0
+				}
+			}
+		}()
+		if searched > len(data) {
+			searched = 0
+		}
+		loc := goPanicStartPat.FindIndex(data[searched:])
+		if loc == nil {
+			// the start of a dump could only be on the last, incomplete line
+			searched = bytes.LastIndexByte(data, '\n') + 1
+			return inner(data, atEOF)
+		}
+		start := searched + loc[0]
+		searched = start
+		if start > 0 {
+			// the data before the panic is complete, whatever inner thinks
+			advance, token, err = inner(data[:start], true)
+			if advance == 0 && token == nil && err == nil {
+				// inner doesn't want it, so skip it
+				return start, nil, nil
+			}
+			return advance, token, err
+		}
+		end, ok := dump.end(data, atEOF, maxBytes)
+		if !ok {
+			return 0, nil, nil
+		}
+		return end, bytes.TrimRight(data[:end], " \t\r\n"), nil
+	}
+}
+
+// goPanicScan is the state of the search for the end of a dump, so that it can
+// carry on where it left off when more data arrives.
+type goPanicScan struct {
+	pos       int
+	header    int
+	inStack   bool
+	goroutine int
+}
+
+// end finds the end of the dump at the start of data. It reports false if it
+// can't tell yet because the dump might continue in data that hasn't arrived.
+// If the dump would be longer than maxBytes, it ends early, at the start of
+// the last goroutine if there is one after the first line.
+func (s *goPanicScan) end(data []byte, atEOF bool, maxBytes int) (int, bool) {
+	for s.pos < len(data) {
+		next := bytes.IndexByte(data[s.pos:], '\n')
+		if next < 0 {
+			if !atEOF {
+				return 0, false
+			}
+			next = len(data) - s.pos
+		}
+		if maxBytes > 0 && s.pos > 0 && s.pos+next+1 > maxBytes {
+			if s.goroutine > 0 {
+				return s.goroutine, true
+			}
+			return s.pos, true
+		}
+		line := string(dropCR(data[s.pos : s.pos+next]))
+		switch {
+		case goroutinePat.MatchString(line):
+			s.inStack = true
+			if s.pos > 0 {
+				s.goroutine = s.pos
+			}
+		case s.pos == 0:
+			// the panic message itself
+		case !s.inStack:
+			s.header++
+			if s.header > goPanicMaxHeader {
+				// that wasn't really a panic; just take the first line
+				return bytes.IndexByte(data, '\n') + 1, true
+			}
+		case !isGoStackLine(line):
+			return s.pos, true
+		}
+		s.pos += next + 1
+	}
+	if !atEOF {
+		return 0, false
+	}
+	return len(data), true
+}
+
+// isGoStackLine reports whether a line could be part of a goroutine's stack,
+// or part of what the runtime writes after it.
+func isGoStackLine(line string) bool {
+	switch {
+	case line == "",
+		strings.HasPrefix(line, "\t"),
+		strings.HasPrefix(line, "created by "),
+		strings.HasPrefix(line, "..."),
+		strings.HasPrefix(line, "exit status "),
+		goFramePat.MatchString(line):
+		return true
+	}
+	return false
+}
+
+// isRuntimeFunction reports whether a function in a stack trace is part of the
+// Go runtime, rather than the code that panicked.
+func isRuntimeFunction(function string) bool {
+	return strings.HasPrefix(function, "runtime.") || function == "panic"
+}
+
+// GoPanicInterpreter parses the Go panics and goroutine dumps that GoPanicSplit
+// returns as tokens. It sets these fields:
+//
+//	msg         the first line, such as "panic: runtime error: index out of range"
+//	panic       the message from that line, if it's a panic or fatal error
+//	level       fatal, if it's a panic or fatal error
+//	goroutines  a list of objects with the id and state of each goroutine,
+//	            and the function, file and line of its top frame
+//	function    the function of the top frame of the first goroutine
+//	file        the file of that frame
+//	line        the line number of that frame
+//	stack       the whole text
+//
+// For the top frame, frames in the runtime package are skipped, since that's
+// not where the problem is; if there are only runtime frames, the first is used.
+//
+// If the data is a dump it is consumed; otherwise it is passed on unchanged.
+// Merge controls what happens to fields that are already in the record.
+type GoPanicInterpreter struct {
+	Merge Merge
+}
+
+var _ Interpreter = GoPanicInterpreter{}
+
+// Interpret implements Interpreter for GoPanicInterpreter
+func (i GoPanicInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	s := strings.TrimRight(string(data), " \t\r\n")
+	if loc := goPanicStartPat.FindStringIndex(s); loc == nil || loc[0] != 0 {
+		return data, fields
+	}
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+
+	found := map[string]interface{}{
+		"msg":   lines[0],
+		"stack": s,
+	}
+	for _, prefix := range []string{"panic: ", "fatal error: "} {
+		if strings.HasPrefix(lines[0], prefix) {
+			found["panic"] = strings.TrimPrefix(lines[0], prefix)
+			found["level"] = "fatal"
+		}
+	}
+
+	goroutines := []interface{}{}
+	var current map[string]interface{}
+	for n, line := range lines {
+		if m := goroutinePat.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			current = map[string]interface{}{"id": id, "state": m[2]}
+			goroutines = append(goroutines, current)
+			continue
+		}
+		if current == nil || !goFramePat.MatchString(line) || n+1 >= len(lines) {
+			continue
+		}
+		fl := goFileLinePat.FindStringSubmatch(lines[n+1])
+		if fl == nil {
+			continue
+		}
+		function := line[:strings.LastIndex(line, "(")]
+		if top, ok := current["function"].(string); ok && (!isRuntimeFunction(top) || isRuntimeFunction(function)) {
+			// we already have the best frame there is
+			continue
+		}
+		lineNum, _ := strconv.Atoi(fl[2])
+		current["function"] = function
+		current["file"] = fl[1]
+		current["line"] = lineNum
+	}
+	if len(goroutines) > 0 {
+		found["goroutines"] = goroutines
+		top := goroutines[0].(map[string]interface{})
+		for _, k := range []string{"function", "file", "line"} {
+			if v, ok := top[k]; ok {
+				found[k] = v
+			}
+		}
+	}
+	return nil, i.Merge.Apply(fields, found)
+}
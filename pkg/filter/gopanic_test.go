@@ -0,0 +1,240 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ndau/writers/pkg/bufio"
+	"github.com/ndau/writers/pkg/ringbuffer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleGoPanic = `panic: runtime error: invalid memory address or nil pointer dereference
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x109d0b7]
+
+goroutine 7 [running]:
+github.com/ndau/ndau/pkg/node.(*App).Commit(0x0, 0xc0000b2000)
+	/go/src/github.com/ndau/ndau/pkg/node/app.go:123 +0x37
+github.com/ndau/ndau/pkg/node.run(...)
+	/go/src/github.com/ndau/ndau/pkg/node/run.go:45
+created by main.main
+	/go/src/github.com/ndau/ndau/cmd/ndaunode/main.go:30 +0x95
+
+goroutine 1 [chan receive, 2 minutes]:
+main.main()
+	/go/src/github.com/ndau/ndau/cmd/ndaunode/main.go:32 +0xb2
+exit status 2`
+
+var sampleGoRepanic = `panic: first [recovered]
+	panic: second
+
+goroutine 1 [running]:
+panic({0x45e2a0, 0x4a8f18})
+	/usr/local/go/src/runtime/panic.go:884 +0x213
+runtime.gopanic(0x0)
+	/usr/local/go/src/runtime/panic.go:100 +0x1
+main.f()
+	/tmp/x.go:8 +0x27
+main.main()
+	/tmp/x.go:12 +0x17`
+
+func TestGoPanicSplit(t *testing.T) {
+	input := "starting\n" + sampleGoPanic + "\nrestarted\n"
+	tokens := splitAll(t, GoPanicSplit(bufio.ScanLines), input)
+	assert.Equal(t, []string{"starting", sampleGoPanic, "restarted"}, tokens)
+
+	// the panic might be the very last thing
+	tokens = splitAll(t, GoPanicSplit(bufio.ScanLines), "starting\n"+sampleGoRepanic)
+	assert.Equal(t, []string{"starting", sampleGoRepanic}, tokens)
+}
+
+func TestGoPanicSplitJSON(t *testing.T) {
+	input := `{"msg":"one"}` + "\n" + sampleGoPanic + "\n" + `{"msg":"two"}` + "\n"
+	tokens := splitAll(t, GoPanicSplit(JSONSplit), input)
+	require.Equal(t, 3, len(tokens), "%q", tokens)
+	assert.Equal(t, `{"msg":"one"}`, strings.TrimSpace(tokens[0]))
+	assert.Equal(t, sampleGoPanic, tokens[1])
+	assert.Equal(t, `{"msg":"two"}`, strings.TrimSpace(tokens[2]))
+}
+
+func TestGoPanicSplitWaits(t *testing.T) {
+	split := GoPanicSplit(bufio.ScanLines)
+	data := []byte("panic: oops\n\ngoroutine 1 [running]:\nmain.main()\n")
+	advance, token, err := split(data, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, advance)
+	assert.Nil(t, token)
+
+	// a line that isn't part of the stack ends it
+	more := append(data, []byte("\t/tmp/x.go:3 +0x1\nnext line\n")...)
+	advance, token, err = split(more, false)
+	assert.NoError(t, err)
+	assert.Equal(t, len(more)-len("next line\n"), advance)
+	assert.Equal(t, "panic: oops\n\ngoroutine 1 [running]:\nmain.main()\n\t/tmp/x.go:3 +0x1", string(token))
+}
+
+func TestGoPanicSplitLongHeader(t *testing.T) {
+	input := "panic: not really\n" + strings.Repeat("more text\n", goPanicMaxHeader+1)
+	tokens := splitAll(t, GoPanicSplit(bufio.ScanLines), input)
+	require.Equal(t, goPanicMaxHeader+2, len(tokens))
+	assert.Equal(t, "panic: not really", tokens[0])
+	assert.Equal(t, "more text", tokens[1])
+}
+
+// goroutineDump makes a dump of n goroutines, like the one a SIGQUIT gives.
+func goroutineDump(n int) string {
+	var b strings.Builder
+	b.WriteString("SIGQUIT: quit\nPC=0x45c1e1 m=0 sigcode=0\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "\ngoroutine %d [select]:\nmain.worker()\n\t/tmp/x.go:%d +0x1\n", i, i)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func TestGoPanicSplitLimit(t *testing.T) {
+	dump := goroutineDump(10)
+	tokens := splitAll(t, GoPanicSplitLimit(bufio.ScanLines, 200), dump+"\nrestarted\n")
+	require.True(t, len(tokens) > 2, "%q", tokens)
+	assert.Equal(t, "restarted", tokens[len(tokens)-1])
+	for i, token := range tokens[:len(tokens)-1] {
+		assert.True(t, len(token) <= 200, token)
+		if i > 0 {
+			// the pieces are split between goroutines
+			assert.True(t, strings.HasPrefix(token, "goroutine "), token)
+		}
+	}
+	assert.Equal(t, dump, strings.Join(tokens[:len(tokens)-1], "\n\n"))
+}
+
+func TestGoPanicSplitIncremental(t *testing.T) {
+	input := "starting\n" + sampleGoPanic + "\nrestarted\n"
+	cbuf := ringbuffer.New(4096)
+	scanner := bufio.NewScanner(cbuf, GoPanicSplit(bufio.ScanLines))
+	tokens := []string{}
+	// dribble the data in, so that the split function sees it many times
+	for i := 0; i < len(input); i += 7 {
+		end := i + 7
+		if end > len(input) {
+			end = len(input)
+		}
+		_, err := cbuf.Write([]byte(input[i:end]))
+		require.NoError(t, err)
+		for scanner.Scan() {
+			tokens = append(tokens, string(scanner.Bytes()))
+		}
+	}
+	require.NoError(t, cbuf.Close())
+	for scanner.Scan() {
+		tokens = append(tokens, string(scanner.Bytes()))
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []string{"starting", sampleGoPanic, "restarted"}, tokens)
+}
+
+func TestGoPanicSplitLargeDump(t *testing.T) {
+	// far more than a scanner can hold in one token
+	dump := goroutineDump(20000)
+	require.True(t, len(dump) > bufio.MaxScanTokenSize)
+	var last map[string]interface{}
+	f := New(GoPanicSplit(bufio.ScanLines), func(m map[string]interface{}) { last = m },
+		WithInterpreters(GoPanicInterpreter{}, LastChanceInterpreter{}))
+	f.Write([]byte(dump + "\nstill here\n"))
+	assert.NoError(t, f.Close())
+	assert.Equal(t, "still here", last["_other"])
+}
+
+func TestGoPanicInterpreter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]interface{}
+	}{
+		{"nil pointer", sampleGoPanic, map[string]interface{}{
+			"msg":      "panic: runtime error: invalid memory address or nil pointer dereference",
+			"panic":    "runtime error: invalid memory address or nil pointer dereference",
+			"level":    "fatal",
+			"function": "github.com/ndau/ndau/pkg/node.(*App).Commit",
+			"file":     "/go/src/github.com/ndau/ndau/pkg/node/app.go",
+			"line":     123,
+			"goroutines": []interface{}{
+				map[string]interface{}{
+					"id": 7, "state": "running",
+					"function": "github.com/ndau/ndau/pkg/node.(*App).Commit",
+					"file":     "/go/src/github.com/ndau/ndau/pkg/node/app.go",
+					"line":     123,
+				},
+				map[string]interface{}{
+					"id": 1, "state": "chan receive, 2 minutes",
+					"function": "main.main",
+					"file":     "/go/src/github.com/ndau/ndau/cmd/ndaunode/main.go",
+					"line":     32,
+				},
+			},
+			"stack": sampleGoPanic,
+		}},
+		{"repanic skips runtime frames", sampleGoRepanic, map[string]interface{}{
+			"msg":      "panic: first [recovered]",
+			"panic":    "first [recovered]",
+			"level":    "fatal",
+			"function": "main.f",
+			"file":     "/tmp/x.go",
+			"line":     8,
+			"goroutines": []interface{}{
+				map[string]interface{}{
+					"id": 1, "state": "running", "function": "main.f", "file": "/tmp/x.go", "line": 8,
+				},
+			},
+			"stack": sampleGoRepanic,
+		}},
+		{"deadlock", "fatal error: all goroutines are asleep - deadlock!\n\ngoroutine 1 [chan receive]:\nruntime.gopark()\n\t/usr/local/go/src/runtime/proc.go:1 +0x1", map[string]interface{}{
+			"msg":      "fatal error: all goroutines are asleep - deadlock!",
+			"panic":    "all goroutines are asleep - deadlock!",
+			"level":    "fatal",
+			"function": "runtime.gopark",
+			"file":     "/usr/local/go/src/runtime/proc.go",
+			"line":     1,
+			"goroutines": []interface{}{
+				map[string]interface{}{
+					"id": 1, "state": "chan receive", "function": "runtime.gopark",
+					"file": "/usr/local/go/src/runtime/proc.go", "line": 1,
+				},
+			},
+			"stack": "fatal error: all goroutines are asleep - deadlock!\n\ngoroutine 1 [chan receive]:\nruntime.gopark()\n\t/usr/local/go/src/runtime/proc.go:1 +0x1",
+		}},
+		{"dump", "goroutine 3 [select]:\nmain.loop()\n\t/tmp/x.go:20", map[string]interface{}{
+			"msg":      "goroutine 3 [select]:",
+			"function": "main.loop",
+			"file":     "/tmp/x.go",
+			"line":     20,
+			"goroutines": []interface{}{
+				map[string]interface{}{"id": 3, "state": "select", "function": "main.loop", "file": "/tmp/x.go", "line": 20},
+			},
+			"stack": "goroutine 3 [select]:\nmain.loop()\n\t/tmp/x.go:20",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, fields := GoPanicInterpreter{}.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Empty(t, data)
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestGoPanicInterpreterPassesOthers(t *testing.T) {
+	data, fields := GoPanicInterpreter{}.Interpret([]byte("not a panic: really"), map[string]interface{}{})
+	assert.Equal(t, "not a panic: really", string(data))
+	assert.Empty(t, fields)
+}
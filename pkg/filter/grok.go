@@ -0,0 +1,241 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// grokPatterns is the built-in library of Grok patterns. They are adapted from
+// the ones that come with Logstash, rewritten where necessary for Go's regexp
+// syntax, which has no lookaround or atomic groups.
+var grokPatterns = map[string]string{
+	"USERNAME":       `[a-zA-Z0-9._-]+`,
+	"USER":           `%{USERNAME}`,
+	"EMAILLOCALPART": `[a-zA-Z0-9._%+-]+`,
+	"EMAILADDRESS":   `%{EMAILLOCALPART}@%{HOSTNAME}`,
+	"INT":            `[+-]?[0-9]+`,
+	"BASE10NUM":      `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"NUMBER":         `%{BASE10NUM}`,
+	"BASE16NUM":      `[+-]?(?:0x)?[0-9A-Fa-f]+`,
+	"POSINT":         `[1-9][0-9]*`,
+	"NONNEGINT":      `[0-9]+`,
+	"WORD":           `\b\w+\b`,
+	"NOTSPACE":       `\S+`,
+	"SPACE":          `\s*`,
+	"DATA":           `.*?`,
+	"GREEDYDATA":     `.*`,
+	"QUOTEDSTRING":   `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`,
+	"QS":             `%{QUOTEDSTRING}`,
+	"UUID":           `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+
+	"IPV4": `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	// Logstash's IPV6: an address without :: compression needs all eight groups,
+	// so that times like 15:04:05 don't match
+	"IPV6": `(?:(?:[0-9A-Fa-f]{1,4}:){7}(?:[0-9A-Fa-f]{1,4}|:)` +
+		`|(?:[0-9A-Fa-f]{1,4}:){6}(?::[0-9A-Fa-f]{1,4}|%{IPV4}|:)` +
+		`|(?:[0-9A-Fa-f]{1,4}:){5}(?:(?::[0-9A-Fa-f]{1,4}){1,2}|:%{IPV4}|:)` +
+		`|(?:[0-9A-Fa-f]{1,4}:){4}(?:(?::[0-9A-Fa-f]{1,4}){1,3}|(?::[0-9A-Fa-f]{1,4})?:%{IPV4}|:)` +
+		`|(?:[0-9A-Fa-f]{1,4}:){3}(?:(?::[0-9A-Fa-f]{1,4}){1,4}|(?::[0-9A-Fa-f]{1,4}){0,2}:%{IPV4}|:)` +
+		`|(?:[0-9A-Fa-f]{1,4}:){2}(?:(?::[0-9A-Fa-f]{1,4}){1,5}|(?::[0-9A-Fa-f]{1,4}){0,3}:%{IPV4}|:)` +
+		`|[0-9A-Fa-f]{1,4}:(?:(?::[0-9A-Fa-f]{1,4}){1,6}|(?::[0-9A-Fa-f]{1,4}){0,4}:%{IPV4}|:)` +
+		`|:(?:(?::[0-9A-Fa-f]{1,4}){1,7}|(?::[0-9A-Fa-f]{1,4}){0,5}:%{IPV4}|:))` +
+		`(?:%[0-9A-Za-z]+)?`,
+	"IP":       `%{IPV6}|%{IPV4}`,
+	"HOSTNAME": `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST": `%{IP}|%{HOSTNAME}`,
+	"HOSTPORT": `%{IPORHOST}:%{POSINT}`,
+
+	"UNIXPATH":     `(?:/[^/\s?#]*)+`,
+	"PATH":         `%{UNIXPATH}`,
+	"URIPROTO":     `[A-Za-z][A-Za-z0-9+\-.]*`,
+	"URIHOST":      `%{IPORHOST}(?::%{POSINT})?`,
+	"URIPATH":      `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":     `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM": `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":          `%{URIPROTO}://(?:%{USER}(?::[^@]*)?@)?(?:%{URIHOST})?(?:%{URIPATHPARAM})?`,
+
+	"MONTH":             `\b(?:[Jj]an(?:uary)?|[Ff]eb(?:ruary)?|[Mm]ar(?:ch)?|[Aa]pr(?:il)?|[Mm]ay|[Jj]une?|[Jj]uly?|[Aa]ug(?:ust)?|[Ss]ep(?:tember)?|[Oo]ct(?:ober)?|[Nn]ov(?:ember)?|[Dd]ec(?:ember)?)\b`,
+	"MONTHNUM":          `0?[1-9]|1[0-2]`,
+	"MONTHDAY":          `0[1-9]|[12][0-9]|3[01]|[1-9]`,
+	"DAY":               `Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?`,
+	"YEAR":              `\d\d(?:\d\d)?`,
+	"HOUR":              `2[0123]|[01]?[0-9]`,
+	"MINUTE":            `[0-5][0-9]`,
+	"SECOND":            `(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}:%{SECOND}`,
+	"ISO8601_TIMEZONE":  `Z|[+-]%{HOUR}(?::?%{MINUTE})?`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?(?:%{ISO8601_TIMEZONE})?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+
+	"LOGLEVEL": `[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo|INFO|[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|[Ee]merg(?:ency)?|EMERG(?:ENCY)?`,
+
+	"COMMONAPACHELOG":   `%{IPORHOST:clientip} %{USER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion})?|%{DATA:rawrequest})" %{NUMBER:response:int} (?:%{NUMBER:bytes:int}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QS:referrer} %{QS:agent}`,
+}
+
+// grokTypes are the conversions that can be named in a Grok reference
+var grokTypes = map[string]Conversion{
+	"int":      ToInt,
+	"float":    ToFloat,
+	"bool":     ToBool,
+	"duration": ToDuration,
+	"string":   nil,
+}
+
+// grokRefPat matches a reference to a pattern: %{NAME}, %{NAME:field} or %{NAME:field:type}
+var grokRefPat = regexp.MustCompile(`%\{(\w+)(?::(\w+))?(?::(\w+))?\}`)
+
+// grokNamePat matches a valid pattern name
+var grokNamePat = regexp.MustCompile(`^\w+$`)
+
+// Grok is a library of Grok patterns, which describe text formats with
+// reusable named regular expressions. In an expression, %{NAME} stands for the
+// pattern called NAME, %{NAME:field} captures the text it matches as field,
+// and %{NAME:field:type} also converts it to type, which can be int, float,
+// bool, duration or string. Everything else is a regular expression in Go's syntax.
+//
+// For example, this matches "1.2.3.4 GET 1234" and captures the client, method
+// and bytes, with bytes as an int:
+//
+//	%{IP:client} %{WORD:method} %{NUMBER:bytes:int}
+type Grok struct {
+	patterns map[string]string
+}
+
+// NewGrok constructs a Grok with the built-in library of patterns, which
+// includes the common ones like WORD, NOTSPACE, DATA, GREEDYDATA, INT, NUMBER,
+// IP, HOSTNAME, URI, TIMESTAMP_ISO8601, HTTPDATE, LOGLEVEL and COMBINEDAPACHELOG.
+func NewGrok() *Grok {
+	g := &Grok{patterns: make(map[string]string, len(grokPatterns))}
+	for name, pattern := range grokPatterns {
+		g.patterns[name] = pattern
+	}
+	return g
+}
+
+// Add adds a pattern to the library, or replaces one that is already there.
+// The pattern may refer to any pattern already in the library. It returns an
+// error, and the library is unchanged, if the pattern doesn't compile or
+// would make a loop.
+func (g *Grok) Add(name, pattern string) error {
+	if !grokNamePat.MatchString(name) {
+		return fmt.Errorf("invalid grok pattern name %q", name)
+	}
+	old, existed := g.patterns[name]
+	g.patterns[name] = pattern
+	if _, _, err := g.Compile("%{" + name + "}"); err != nil {
+		if existed {
+			g.patterns[name] = old
+		} else {
+			delete(g.patterns, name)
+		}
+		return fmt.Errorf("grok pattern %s: %s", name, err)
+	}
+	return nil
+}
+
+// Compile expands the pattern references in a Grok expression and compiles the
+// result. It returns the regular expression and the conversions for the fields
+// that were given types, or an error if a reference is to a pattern that
+// doesn't exist, names an unknown type, or is circular, or if the expansion
+// isn't a valid regular expression.
+func (g *Grok) Compile(expr string) (*regexp.Regexp, map[string]Conversion, error) {
+	types := map[string]Conversion{}
+	expanded, err := g.expand(expr, types, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, nil, err
+	}
+	return re, types, nil
+}
+
+// expand replaces the references in expr with the patterns they refer to,
+// recursively. seen holds the names of the patterns being expanded, to catch loops.
+func (g *Grok) expand(expr string, types map[string]Conversion, seen []string) (string, error) {
+	var out strings.Builder
+	last := 0
+	for _, loc := range grokRefPat.FindAllStringSubmatchIndex(expr, -1) {
+		out.WriteString(expr[last:loc[0]])
+		last = loc[1]
+
+		name := expr[loc[2]:loc[3]]
+		for _, s := range seen {
+			if s == name {
+				return "", fmt.Errorf("grok pattern %s refers to itself", name)
+			}
+		}
+		pattern, ok := g.patterns[name]
+		if !ok {
+			return "", fmt.Errorf("unknown grok pattern %s", name)
+		}
+		inner, err := g.expand(pattern, types, append(seen, name))
+		if err != nil {
+			return "", err
+		}
+
+		if loc[4] < 0 {
+			out.WriteString("(?:" + inner + ")")
+			continue
+		}
+		field := expr[loc[4]:loc[5]]
+		out.WriteString("(?P<" + field + ">" + inner + ")")
+		if loc[6] >= 0 {
+			typ := expr[loc[6]:loc[7]]
+			convert, ok := grokTypes[typ]
+			if !ok {
+				return "", fmt.Errorf("unknown type %s for grok field %s", typ, field)
+			}
+			if convert != nil {
+				types[field] = convert
+			}
+		}
+	}
+	out.WriteString(expr[last:])
+	return out.String(), nil
+}
+
+// Interpreter constructs a RegexInterpreter from Grok expressions, which are
+// tried in order, as described for RegexInterpreter. It returns an error if
+// any of the expressions doesn't compile or captures no fields.
+func (g *Grok) Interpreter(exprs ...string) (RegexInterpreter, error) {
+	i := RegexInterpreter{Types: map[string]Conversion{}}
+	for _, expr := range exprs {
+		re, types, err := g.Compile(expr)
+		if err != nil {
+			return i, err
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			named = named || name != ""
+		}
+		if !named {
+			return i, fmt.Errorf("grok expression %q captures no fields", expr)
+		}
+		i.Patterns = append(i.Patterns, re)
+		for field, convert := range types {
+			i.Types[field] = convert
+		}
+	}
+	return i, nil
+}
+
+// NewGrokInterpreter constructs a RegexInterpreter from Grok expressions that
+// use the built-in library of patterns.
+func NewGrokInterpreter(exprs ...string) (RegexInterpreter, error) {
+	return NewGrok().Interpreter(exprs...)
+}
@@ -0,0 +1,147 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrokLibraryCompiles(t *testing.T) {
+	g := NewGrok()
+	for name := range grokPatterns {
+		_, _, err := g.Compile("%{" + name + "}")
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestGrokPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		want    bool
+	}{
+		{"IP", "192.168.1.254", true},
+		{"IP", "::1", true},
+		{"IP", "2001:db8::ff00:42:8329", true},
+		{"IP", "1:2:3:4:5:6:7:8", true},
+		{"IP", "::ffff:192.0.2.128", true},
+		{"IP", "fe80::1%eth0", true},
+		{"IP", "15:04:05", false},
+		{"IPV6", "1:2:3:4:5:6:7", false},
+		{"IPORHOST", "15:04:05", false},
+		{"IPV4", "256.1.1.1", false},
+		{"HOSTNAME", "node-1.example.com", true},
+		{"NUMBER", "-12.5", true},
+		{"INT", "12.5", false},
+		{"LOGLEVEL", "WARNING", true},
+		{"TIMESTAMP_ISO8601", "2019-04-18T15:18:28.565Z", true},
+		{"TIMESTAMP_ISO8601", "2019-04-18 15:18:28,565", true},
+		{"HTTPDATE", "10/Oct/2000:13:55:36 -0700", true},
+		{"SYSLOGTIMESTAMP", "Jan  2 22:14:15", true},
+		{"QUOTEDSTRING", `"say \"hi\""`, true},
+		{"UUID", "123e4567-e89b-12d3-a456-426614174000", true},
+		{"URI", "https://user@example.com:8080/a/b?c=d", true},
+		{"EMAILADDRESS", "ops@example.com", true},
+	}
+	g := NewGrok()
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.input, func(t *testing.T) {
+			re, _, err := g.Compile("^(?:%{" + tt.pattern + "})$")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, re.MatchString(tt.input))
+		})
+	}
+}
+
+func TestGrokInterpreter(t *testing.T) {
+	i, err := NewGrokInterpreter(
+		`^%{IP:client} %{WORD:method} %{URIPATHPARAM:path} %{NUMBER:bytes:int} %{NUMBER:duration:float}$`,
+		`^%{LOGLEVEL:level}: %{GREEDYDATA:msg}$`,
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		input    string
+		wantData string
+		want     map[string]interface{}
+	}{
+		{"55.3.244.1 GET /index.html 15824 0.043\n", "", map[string]interface{}{
+			"client": "55.3.244.1", "method": "GET", "path": "/index.html", "bytes": 15824, "duration": 0.043,
+		}},
+		{"ERROR: it broke", "", map[string]interface{}{"level": "ERROR", "msg": "it broke"}},
+		{"something else", "something else", map[string]interface{}{}},
+		// a time is not an IPv6 address
+		{"15:04:05 GET /index.html 15824 0.043", "15:04:05 GET /index.html 15824 0.043", map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			data, fields := i.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Equal(t, tt.wantData, string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestGrokCombinedApacheLog(t *testing.T) {
+	i, err := NewGrokInterpreter(`^%{COMBINEDAPACHELOG}$`)
+	require.NoError(t, err)
+	line := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`
+	data, fields := i.Interpret([]byte(line), map[string]interface{}{})
+	assert.Empty(t, data)
+	assert.Equal(t, map[string]interface{}{
+		"clientip": "127.0.0.1", "ident": "-", "auth": "frank", "timestamp": "10/Oct/2000:13:55:36 -0700",
+		"verb": "GET", "request": "/apache_pb.gif", "httpversion": "1.0", "response": 200, "bytes": 2326,
+		"referrer": `"http://www.example.com/start.html"`, "agent": `"Mozilla/4.08"`,
+	}, fields)
+}
+
+func TestGrokUserPatterns(t *testing.T) {
+	g := NewGrok()
+	require.NoError(t, g.Add("HEIGHT", `%{POSINT}`))
+	require.NoError(t, g.Add("BLOCK", `height=%{HEIGHT:height:int} hash=%{BASE16NUM:hash}`))
+	i, err := g.Interpreter(`Executed block %{BLOCK}`)
+	require.NoError(t, err)
+	_, fields := i.Interpret([]byte("Executed block height=5 hash=3D4F"), map[string]interface{}{})
+	assert.Equal(t, map[string]interface{}{"height": 5, "hash": "3D4F"}, fields)
+
+	// the built-in library isn't changed by adding to one Grok
+	_, _, err = NewGrok().Compile("%{HEIGHT}")
+	assert.Error(t, err)
+}
+
+func TestGrokErrors(t *testing.T) {
+	g := NewGrok()
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"bad name", g.Add("NOT A NAME", `x`)},
+		{"unknown reference", g.Add("X", `%{NOPE}`)},
+		{"bad regexp", g.Add("X", `(%{INT}`)},
+		{"self reference", g.Add("INT", `%{INT}`)},
+		{"unknown type", func() error { _, _, err := g.Compile(`%{INT:n:complex}`); return err }()},
+		{"no fields", func() error { _, err := g.Interpreter(`%{INT} %{WORD}`); return err }()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.err)
+		})
+	}
+	// failed additions leave the library alone
+	re, _, err := g.Compile(`^%{INT}$`)
+	require.NoError(t, err)
+	assert.True(t, re.MatchString("42"))
+	assert.IsType(t, &regexp.Regexp{}, re)
+}
@@ -11,8 +11,12 @@ package filter
 
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,23 +36,51 @@ type Interpreter interface {
 // collection to the output unchanged.
 // The assumption is that data is a single json object; use JSONSplit and a
 // scanner to read the appropriate data from a Reader.
-type JSONInterpreter struct{}
+//
+// By default, numbers are decoded as float64, which can't exactly represent
+// integers larger than 2^53, such as nanosecond timestamps or large napu amounts.
+// Set UseNumber to decode every number (including those in nested objects and
+// arrays) as a json.Number instead, which keeps the original text of the number
+// so that it is written back out exactly as it came in.
+//
+// Merge controls what happens to fields that are already in the record.
+type JSONInterpreter struct {
+	UseNumber bool
+	Merge     Merge
+}
 
 var _ Interpreter = JSONInterpreter{}
 
 // Interpret implements Interpreter for JSONInterpreter
-func (JSONInterpreter) Interpret(data []byte,
+func (i JSONInterpreter) Interpret(data []byte,
 	fields map[string]interface{}) ([]byte, map[string]interface{}) {
 	var parsed map[string]interface{}
-	err := json.Unmarshal(data, &parsed)
+	var err error
+	if i.UseNumber {
+		parsed, err = decodeUseNumber(data)
+	} else {
+		err = json.Unmarshal(data, &parsed)
+	}
 	if err != nil {
 		// if it wasn't json, just do nothing
 		return data, fields
 	}
-	for k, v := range parsed {
-		fields[k] = v
+	return nil, i.Merge.Apply(fields, parsed)
+}
+
+// decodeUseNumber is json.Unmarshal into a map, but with numbers decoded as json.Number.
+// Like json.Unmarshal, it fails if there is anything after the object but whitespace.
+func decodeUseNumber(data []byte) (map[string]interface{}, error) {
+	var parsed map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&parsed); err != nil {
+		return nil, err
 	}
-	return nil, fields
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid data after top-level value")
+	}
+	return parsed, nil
 }
 
 // LastChanceInterpreter should be the last Interpreter in the chain. It
@@ -56,8 +88,10 @@ func (JSONInterpreter) Interpret(data []byte,
 // the field _other to the result. We're assuming since this was intended
 // to be a log entry that the data is mostly string-like, but there is
 // the option to run an Escaper over it so that we don't try to print gibberish.
+// Merge controls what happens if there is already an _other field.
 type LastChanceInterpreter struct {
 	Escaper func([]byte) string
+	Merge   Merge
 }
 
 var _ Interpreter = LastChanceInterpreter{}
@@ -67,9 +101,9 @@ func (i LastChanceInterpreter) Interpret(data []byte,
 	fields map[string]interface{}) ([]byte, map[string]interface{}) {
 	if len(data) != 0 {
 		if i.Escaper != nil {
-			fields["_other"] = i.Escaper(data)
+			fields = i.Merge.Set(fields, "_other", i.Escaper(data))
 		} else {
-			fields["_other"] = string(data)
+			fields = i.Merge.Set(fields, "_other", string(data))
 		}
 	}
 	return nil, fields
@@ -78,9 +112,11 @@ func (i LastChanceInterpreter) Interpret(data []byte,
 // RequiredFieldsInterpreter simply copies its default fields into the
 // destination and then passes on its input data unexamined.
 // You can control whether these fields override existing fields
-// or are overridden by where this sits in the stack of interpreters.
+// or are overridden by where this sits in the stack of interpreters,
+// and by the Merge policies of this and the other interpreters.
 type RequiredFieldsInterpreter struct {
 	Defaults map[string]interface{}
+	Merge    Merge
 }
 
 var _ Interpreter = RequiredFieldsInterpreter{}
@@ -88,45 +124,58 @@ var _ Interpreter = RequiredFieldsInterpreter{}
 // Interpret implements Interpreter for RequiredFieldsInterpreter
 func (i RequiredFieldsInterpreter) Interpret(data []byte,
 	fields map[string]interface{}) ([]byte, map[string]interface{}) {
-	for k, v := range i.Defaults {
-		fields[k] = v
-	}
-	return data, fields
+	return data, i.Merge.Apply(fields, i.Defaults)
 }
 
 // TendermintInterpreter looks at the specific keys specified
 // and attempts to interpret them further by parsing them for
 // things that look like "name: value". You'd generally want to
 // put this in the list after a JSONInterpreter has split the
-// file up.
+// file up. Merge controls what happens to fields that are already in the record.
+//
+// Tendermint also dumps whole structures into a message, as brace-delimited
+// blocks such as Block{ Header{ Height: 5 ... }#hash }#hash. If Nested is set,
+// each of these is rebuilt as an object and stored under its name, so that the
+// height in that example is at Block.Header.Height. Within these objects, hashes
+// are stored as Hash values and timestamps as time.Time.
+//
+// Paths maps dotted paths into the blocks, like "Block.Header.Height", to fields
+// that the values found there are copied to. This works whether or not Nested
+// is set.
 type TendermintInterpreter struct {
-	Keys []string
+	Keys   []string
+	Nested bool
+	Paths  map[string]string
+	Merge  Merge
 }
 
 // NewTendermintInterpreter constructs a TendermintInterpreter with the
-// one field that is currently worth searching: _msg
+// one field that is currently worth searching: _msg. It only extracts
+// the flat fields; set Nested to rebuild the blocks as well.
 func NewTendermintInterpreter() Interpreter {
 	return TendermintInterpreter{Keys: []string{"_msg"}}
 }
 
 var _ Interpreter = TendermintInterpreter{}
 
-func findFields(v string, fields map[string]interface{}) map[string]interface{} {
-	// pattern for matching lines that have Key: value as long as that line doesn't end in curly brace.
-	// This pattern is specific to some odd data that Tendermint shoves into a single log message
-	// without using the JSON logging. It's not intended to be a general-purpose key/value matcher.
-	lpat := regexp.MustCompile(`^([A-Z][A-Za-z0-9]+):[ \t]*(.*[^{])$`)
-	// pattern for splitting up lines including trailing and leading whitespace
-	spat := regexp.MustCompile(`[ \t]*\n[ \t]*`)
-	ss := spat.Split(v, -1)
+// pattern for matching lines that have Key: value as long as that line doesn't end in curly brace.
+// This pattern is specific to some odd data that Tendermint shoves into a single log message
+// without using the JSON logging. It's not intended to be a general-purpose key/value matcher.
+var tmFieldPat = regexp.MustCompile(`^([A-Z][A-Za-z0-9]+):[ \t]*(.*[^{])$`)
+
+// pattern for splitting up lines including trailing and leading whitespace
+var tmLinePat = regexp.MustCompile(`[ \t]*\n[ \t]*`)
+
+func findFields(v string, fields map[string]interface{}, merge Merge) map[string]interface{} {
+	ss := tmLinePat.Split(v, -1)
 	for _, s := range ss {
-		r := lpat.FindStringSubmatch(s)
+		r := tmFieldPat.FindStringSubmatch(s)
 		if r != nil {
 			n, err := strconv.Atoi(r[2])
 			if err != nil {
-				fields[r[1]] = r[2]
+				fields = merge.Set(fields, r[1], r[2])
 			} else {
-				fields[r[1]] = n
+				fields = merge.Set(fields, r[1], n)
 			}
 		}
 	}
@@ -141,11 +190,32 @@ func (i TendermintInterpreter) Interpret(data []byte,
 		if !ok {
 			continue
 		}
-		switch s := v.(type) {
+		var s string
+		switch t := v.(type) {
 		case string:
-			fields = findFields(s, fields)
+			s = t
 		case []byte:
-			fields = findFields(string(s), fields)
+			s = string(t)
+		default:
+			continue
+		}
+		fields = findFields(s, fields, i.Merge)
+		if !i.Nested && len(i.Paths) == 0 {
+			continue
+		}
+		blocks := parseBlocks(s)
+		if i.Nested {
+			fields = i.Merge.Apply(fields, blocks)
+		}
+		paths := make([]string, 0, len(i.Paths))
+		for path := range i.Paths {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if v, ok := lookupPath(blocks, path); ok {
+				fields = i.Merge.Set(fields, i.Paths[path], v)
+			}
 		}
 	}
 	return data, fields
@@ -156,47 +226,101 @@ func (i TendermintInterpreter) Interpret(data []byte,
 // Example:
 // 66940:C 18 Apr 2019 15:18:28.565 # Configuration loaded
 // pid:role timestamp loglevel message
-type RedisInterpreter struct{}
+//
+// Older versions leave the year or the milliseconds out of the timestamp, and
+// the oldest write [pid] with no role. A timestamp without a year is put in the
+// year that makes it closest to the current time according to Clock (or the
+// system clock if that is nil).
+//
+// The roles are X for sentinel, C for child, M for master, and S (or R) for a
+// replica, which is called "slave" unless UseReplica is set. Well-known messages,
+// such as the one that says the server is ready to accept connections and the
+// ones about saving and replication, are identified in the event field.
+//
+// Anything else is stored in _txt. Use RedisSplit as the splitter to keep the
+// lines of a multi-line block, like the ASCII-art banner Redis prints at startup,
+// together; the banner gets the event "banner", and the version, mode, port and
+// pid from it are extracted.
+//
+// Merge controls what happens to fields that are already in the record.
+type RedisInterpreter struct {
+	UseReplica bool
+	Clock      func() time.Time
+	Merge      Merge
+}
 
 var _ Interpreter = RedisInterpreter{}
 
+// redisLinePat matches a line of the redis logs
+var redisLinePat = regexp.MustCompile(`^(?:([0-9]+):([XCSMR])|\[([0-9]+)\]) ` +
+	`([0-9]+ [A-Za-z]+ (?:[0-9]{4} )?[0-9:.]+) ([.*#-]) (.*)$`)
+
+// redisTimeLayouts are the layouts of the timestamps in the different versions of redis
+var redisTimeLayouts = []struct {
+	layout  string
+	hasYear bool
+}{
+	{"2 Jan 2006 15:04:05.000", true},
+	{"2 Jan 2006 15:04:05", true},
+	{"2 Jan 15:04:05.000", false},
+	{"2 Jan 15:04:05", false},
+}
+
 // Interpret implements Interpreter for RedisInterpreter
 func (i RedisInterpreter) Interpret(data []byte,
 	fields map[string]interface{}) ([]byte, map[string]interface{}) {
-	pat := regexp.MustCompile("^([0-9]+):([XCSM]) " +
-		"([0-9]+ [A-Za-z]+ [0-9]+ [0-9:.]+) ([.*#-]) (.*)$")
 	s := strings.TrimSpace(string(data))
 	// don't do anything for empty strings
 	if s == "" {
 		return nil, fields
 	}
-	matches := pat.FindStringSubmatch(s)
+	matches := redisLinePat.FindStringSubmatch(s)
 	if matches == nil {
 		// if the match failed, just save the raw message
 		// but we still say we processed all the data
-		fields["_txt"] = s
-		return nil, fields
+		found := redisBlock(s)
+		if strings.Contains(s, "\n") {
+			// keep the indentation of a block, which may be ASCII art
+			s = strings.TrimRight(string(data), " \t\r\n")
+		}
+		found["_txt"] = s
+		return nil, i.Merge.Apply(fields, found)
 	}
 
 	// ok, we did get a match, now divide it up
-	fields["pid"] = matches[1]
+	found := map[string]interface{}{}
+	if matches[1] != "" {
+		found["pid"] = matches[1]
+	} else {
+		found["pid"] = matches[3]
+	}
 	switch matches[2] {
 	case "X":
-		fields["role"] = "sentinel"
+		found["role"] = "sentinel"
 	case "C":
-		fields["role"] = "child"
-	case "S":
-		fields["role"] = "slave"
+		found["role"] = "child"
+	case "S", "R":
+		if i.UseReplica || matches[2] == "R" {
+			found["role"] = "replica"
+		} else {
+			found["role"] = "slave"
+		}
 	case "M":
-		fields["role"] = "master"
+		found["role"] = "master"
 	}
 
-	ts := matches[3]
-	t, err := time.Parse("02 Jan 2006 15:04:05.000", ts)
-	if err != nil {
-		fields["timestamp"] = ts
-	} else {
-		fields["timestamp"] = t.Format(time.RFC3339Nano)
+	ts := matches[4]
+	found["timestamp"] = ts
+	for _, l := range redisTimeLayouts {
+		t, err := time.Parse(l.layout, ts)
+		if err != nil {
+			continue
+		}
+		if !l.hasYear {
+			t = inferYear(t, i.Clock)
+		}
+		found["timestamp"] = t.Format(time.RFC3339Nano)
+		break
 	}
 
 	// redis log levels are as follows
@@ -205,16 +329,19 @@ func (i RedisInterpreter) Interpret(data []byte,
 	// * notice
 	// # warning
 	// there is no "error" level, so we map "verbose" to "debug"
-	switch matches[4] {
+	switch matches[5] {
 	case ".":
-		fields["level"] = "debug"
+		found["level"] = "debug"
 	case "-":
-		fields["level"] = "debug"
+		found["level"] = "debug"
 	case "*":
-		fields["level"] = "info"
+		found["level"] = "info"
 	case "#":
-		fields["level"] = "warn"
+		found["level"] = "warn"
 	}
-	fields["msg"] = matches[5]
-	return nil, fields
+	found["msg"] = matches[6]
+	if event := redisEvent(matches[6]); event != "" {
+		found["event"] = event
+	}
+	return nil, i.Merge.Apply(fields, found)
 }
@@ -11,11 +11,15 @@ package filter
 
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestJSONInterpreter_Interpret(t *testing.T) {
@@ -261,3 +265,47 @@ func TestRedisInterpreterReal(t *testing.T) {
 		}
 	}
 }
+
+func TestJSONInterpreterUseNumber(t *testing.T) {
+	r := JSONInterpreter{UseNumber: true}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantlen int
+		wantf   map[string]interface{}
+	}{
+		{"not json", "hi", 2, map[string]interface{}{}},
+		{"trailing garbage", `{"a":1} x`, 9, map[string]interface{}{}},
+		{"two objects", `{"a":1}{"b":2}`, 14, map[string]interface{}{}},
+		{"trailing space", `{"a":1}  `, 0, map[string]interface{}{"a": json.Number("1")}},
+		{"big", `{"height":9007199254740993,"ns":1555600708565123456}`, 0, map[string]interface{}{
+			"height": json.Number("9007199254740993"),
+			"ns":     json.Number("1555600708565123456"),
+		}},
+		{"float", `{"f":1.50}`, 0, map[string]interface{}{"f": json.Number("1.50")}},
+		{"nested", `{"o":{"n":[18446744073709551617]}}`, 0, map[string]interface{}{
+			"o": map[string]interface{}{"n": []interface{}{json.Number("18446744073709551617")}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotbytes, gotfields := r.Interpret([]byte(tt.input), map[string]interface{}{})
+			if len(gotbytes) != tt.wantlen {
+				t.Errorf("JSONInterpreter.Interpret() return %d bytes, expected %d", len(gotbytes), tt.wantlen)
+			}
+			if !reflect.DeepEqual(gotfields, tt.wantf) {
+				t.Errorf("JSONInterpreter.Interpret() got1 = %v, want %v", gotfields, tt.wantf)
+			}
+		})
+	}
+}
+
+func TestJSONInterpreterRoundTrip(t *testing.T) {
+	input := `{"amount":123456789012345678901,"height":9007199254740993,"rate":0.1000000000000000055511151231257827}`
+	buf := &bytes.Buffer{}
+	filter := NewWithSink(JSONSplit, NewJSONSink(buf), WithInterpreters(JSONInterpreter{UseNumber: true}))
+	filter.Write([]byte(input))
+	assert.Nil(t, filter.Close())
+	assert.Equal(t, input+"\n", buf.String())
+}
@@ -48,6 +48,13 @@ func JSONSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	// pull off everything up to the start pattern; if there's any non-whitespace, return it
 	starts := startpat.FindIndex(data)
 	if starts == nil {
+		// at EOF there's never going to be another object, so whatever is left is a message
+		if atEOF {
+			if rest := bytes.TrimSpace(data); len(rest) > 0 {
+				return len(data), wrapMsg(rest), nil
+			}
+			return len(data), nil, nil
+		}
 		return 0, nil, nil
 	}
 	start := starts[0]
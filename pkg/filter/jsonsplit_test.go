@@ -43,6 +43,9 @@ func TestJSONSplit(t *testing.T) {
 		{"unmatched nesting", args{`{"a":{"b":17}`, true}, 13, `{"_msg": "{\"a\":{\"b\":17}"}`, false},
 		{"unmatched quote", args{`{"a":"}`, true}, 7, `{"_msg": "{\"a\":\"}"}`, false},
 		{"tendermint", args{sampleTmJson, false}, len(sampleTmJson), sampleTmJson, false},
+		{"trailing text", args{"  hello\n", false}, 0, "", false},
+		{"trailing text EOF", args{"  hello\n", true}, 8, `{"_msg": "hello"}`, false},
+		{"trailing whitespace EOF", args{" \n ", true}, 3, "", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,166 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultLevelKeys are the fields LevelInterpreter looks in if it isn't given any
+var DefaultLevelKeys = []string{"level", "lvl", "severity", "loglevel"}
+
+// levelNames maps the level names and symbols used by various loggers to our
+// level names: trace, debug, info, warn, error and fatal. The keys are lower case.
+var levelNames = map[string]string{
+	// our own names, and the logrus and zap names
+	"trace":   "trace",
+	"debug":   "debug",
+	"info":    "info",
+	"warn":    "warn",
+	"warning": "warn",
+	"error":   "error",
+	"dpanic":  "error",
+	"panic":   "fatal",
+	"fatal":   "fatal",
+	// syslog severities, and their long forms
+	"emerg":         "fatal",
+	"emergency":     "fatal",
+	"alert":         "fatal",
+	"crit":          "fatal",
+	"critical":      "fatal",
+	"err":           "error",
+	"notice":        "info",
+	"informational": "info",
+	// the letters used by Tendermint and glog
+	"t": "trace",
+	"d": "debug",
+	"i": "info",
+	"w": "warn",
+	"e": "error",
+	"f": "fatal",
+	// the Redis symbols; verbose is mapped to debug, as in RedisInterpreter
+	".":       "debug",
+	"-":       "debug",
+	"verbose": "debug",
+	"*":       "info",
+	"#":       "warn",
+}
+
+// LevelInterpreter normalizes the level of a record. It looks for the level in
+// each of Keys in turn (or DefaultLevelKeys, if Keys is empty), and stores the
+// first one it finds in Target (or "level", if Target is empty) as one of trace,
+// debug, info, warn, error or fatal.
+//
+// It understands the names used by logrus, zap and syslog, the numeric syslog
+// severities 0 to 7, the letters Tendermint uses, and the symbols Redis uses.
+// Names are matched regardless of case. Aliases can add more names, or replace
+// these; its keys must be lower case. A value that isn't recognized is mapped
+// to Default, or info if that is empty.
+//
+// Whenever the original value is not exactly the level stored, it is kept in
+// OriginalKey (or "level_original", if that is empty). Records that have none of
+// the keys are left alone. The data is always passed on unchanged.
+//
+// Target is always replaced, since normalizing it is the point; Merge controls
+// what happens if OriginalKey is already in the record.
+type LevelInterpreter struct {
+	Keys        []string
+	Target      string
+	OriginalKey string
+	Default     string
+	Aliases     map[string]string
+	Merge       Merge
+}
+
+var _ Interpreter = LevelInterpreter{}
+
+// Interpret implements Interpreter for LevelInterpreter
+func (i LevelInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	keys := i.Keys
+	if len(keys) == 0 {
+		keys = DefaultLevelKeys
+	}
+	for _, k := range keys {
+		v, ok := fields[k]
+		if !ok || v == nil {
+			continue
+		}
+		level, ok := i.normalize(v)
+		if !ok {
+			level = i.Default
+			if level == "" {
+				level = "info"
+			}
+		}
+		target := i.Target
+		if target == "" {
+			target = "level"
+		}
+		fields[target] = level
+		if original, ok := v.(string); !ok || original != level {
+			key := i.OriginalKey
+			if key == "" {
+				key = "level_original"
+			}
+			fields = i.Merge.Set(fields, key, v)
+		}
+		return data, fields
+	}
+	return data, fields
+}
+
+// normalize maps a level value to one of our level names, if it can.
+func (i LevelInterpreter) normalize(v interface{}) (string, bool) {
+	var s string
+	switch t := v.(type) {
+	case string:
+		s = t
+	case []byte:
+		s = string(t)
+	case int:
+		return syslogLevel(int64(t))
+	case int64:
+		return syslogLevel(t)
+	case float64:
+		if t != math.Trunc(t) {
+			return "", false
+		}
+		return syslogLevel(int64(t))
+	case json.Number:
+		s = t.String()
+	default:
+		s = fmt.Sprint(t)
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	if level, ok := i.Aliases[s]; ok {
+		return level, true
+	}
+	if level, ok := levelNames[s]; ok {
+		return level, true
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return syslogLevel(n)
+	}
+	return "", false
+}
+
+// syslogLevel maps a numeric syslog severity to our level name.
+func syslogLevel(n int64) (string, bool) {
+	if n < 0 || n >= int64(len(syslogLevels)) {
+		return "", false
+	}
+	return syslogLevels[n], true
+}
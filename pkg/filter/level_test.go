@@ -0,0 +1,93 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelInterpreter(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{"no level", map[string]interface{}{"msg": "hi"}, map[string]interface{}{"msg": "hi"}},
+		{"already canonical", map[string]interface{}{"level": "warn"}, map[string]interface{}{"level": "warn"}},
+		{"upper case", map[string]interface{}{"level": "ERROR"}, map[string]interface{}{
+			"level": "error", "level_original": "ERROR",
+		}},
+		{"logrus", map[string]interface{}{"level": "warning"}, map[string]interface{}{
+			"level": "warn", "level_original": "warning",
+		}},
+		{"zap", map[string]interface{}{"level": "dpanic"}, map[string]interface{}{
+			"level": "error", "level_original": "dpanic",
+		}},
+		{"lvl", map[string]interface{}{"lvl": "dbug"}, map[string]interface{}{
+			"lvl": "dbug", "level": "info", "level_original": "dbug",
+		}},
+		{"tendermint letter", map[string]interface{}{"lvl": "I"}, map[string]interface{}{
+			"lvl": "I", "level": "info", "level_original": "I",
+		}},
+		{"redis symbol", map[string]interface{}{"level": "#"}, map[string]interface{}{
+			"level": "warn", "level_original": "#",
+		}},
+		{"syslog name", map[string]interface{}{"severity": "crit"}, map[string]interface{}{
+			"severity": "crit", "level": "fatal", "level_original": "crit",
+		}},
+		{"syslog number", map[string]interface{}{"severity": 3}, map[string]interface{}{
+			"severity": 3, "level": "error", "level_original": 3,
+		}},
+		{"float number", map[string]interface{}{"severity": 7.0}, map[string]interface{}{
+			"severity": 7.0, "level": "debug", "level_original": 7.0,
+		}},
+		{"json number", map[string]interface{}{"severity": json.Number("4")}, map[string]interface{}{
+			"severity": json.Number("4"), "level": "warn", "level_original": json.Number("4"),
+		}},
+		{"numeric string", map[string]interface{}{"severity": "6"}, map[string]interface{}{
+			"severity": "6", "level": "info", "level_original": "6",
+		}},
+		{"out of range", map[string]interface{}{"severity": 8}, map[string]interface{}{
+			"severity": 8, "level": "info", "level_original": 8,
+		}},
+		{"first key wins", map[string]interface{}{"level": "debug", "lvl": "E"}, map[string]interface{}{
+			"level": "debug", "lvl": "E",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, fields := LevelInterpreter{}.Interpret([]byte("rest"), tt.fields)
+			assert.Equal(t, "rest", string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestLevelInterpreterOptions(t *testing.T) {
+	i := LevelInterpreter{
+		Keys:        []string{"sev"},
+		Target:      "lvl",
+		OriginalKey: "raw",
+		Default:     "warn",
+		Aliases:     map[string]string{"noisy": "trace"},
+	}
+	_, fields := i.Interpret(nil, map[string]interface{}{"sev": "Noisy", "level": "E"})
+	assert.Equal(t, map[string]interface{}{"sev": "Noisy", "level": "E", "lvl": "trace", "raw": "Noisy"}, fields)
+	_, fields = i.Interpret(nil, map[string]interface{}{"sev": "bogus"})
+	assert.Equal(t, map[string]interface{}{"sev": "bogus", "lvl": "warn", "raw": "bogus"}, fields)
+
+	i = LevelInterpreter{Merge: Merge{Policy: KeepFirst}}
+	_, fields = i.Interpret(nil, map[string]interface{}{"level": "E", "level_original": "x"})
+	assert.Equal(t, map[string]interface{}{"level": "error", "level_original": "x"}, fields)
+}
@@ -0,0 +1,203 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LogfmtInterpreter parses lines in logfmt format, like
+// ts=2019-04-18T15:18:28.565Z level=info msg="hello world" k=v
+//
+// Keys are identifiers: a letter or underscore, then letters, digits,
+// underscores, dots and dashes. Values may be double-quoted, with the same
+// escapes as a Go string. A key followed by = and nothing else is set to the
+// empty string. If a key appears more than once, its field is a list of all of
+// its values, in order.
+//
+// Values are strings unless Coerce is set, in which case unquoted values that
+// look like integers, floats or booleans are stored as those types.
+//
+// If BareKeys is set, a key with no = after it (a bare key) is allowed, and is
+// set to true. Since a line of prose with an = in it would otherwise be taken
+// for a list of bare keys, a line with more bare keys than key=value pairs is
+// still not treated as logfmt.
+//
+// The data is only consumed if the whole line parses and it has at least one
+// key=value pair; otherwise it is passed on unchanged.
+// Merge controls what happens to fields that are already in the record.
+type LogfmtInterpreter struct {
+	Coerce   bool
+	BareKeys bool
+	Merge    Merge
+}
+
+var _ Interpreter = LogfmtInterpreter{}
+
+// Interpret implements Interpreter for LogfmtInterpreter
+func (i LogfmtInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	pairs, ok := parseKeyValues(strings.TrimRight(string(data), "\r\n"), i.BareKeys)
+	if !ok {
+		return data, fields
+	}
+	bare := 0
+	for _, p := range pairs {
+		if p.bare {
+			bare++
+		}
+	}
+	if len(pairs)-bare == 0 || bare > len(pairs)-bare {
+		return data, fields
+	}
+
+	found := map[string]interface{}{}
+	order := []string{}
+	for _, p := range pairs {
+		var v interface{} = p.value
+		if i.Coerce || p.bare {
+			v = p.typed()
+		}
+		existing, ok := found[p.key]
+		if !ok {
+			found[p.key] = v
+			order = append(order, p.key)
+			continue
+		}
+		if list, ok := existing.([]interface{}); ok {
+			found[p.key] = append(list, v)
+		} else {
+			found[p.key] = []interface{}{existing, v}
+		}
+	}
+	for _, k := range order {
+		fields = i.Merge.Set(fields, k, found[k])
+	}
+	return nil, fields
+}
+
+// keyValue is one key=value pair from a line of text
+type keyValue struct {
+	key    string
+	value  string
+	quoted bool
+	bare   bool
+}
+
+// typed returns the pair's value as the type it looks like: a bare key is true,
+// and an unquoted value is converted by typedValue.
+func (p keyValue) typed() interface{} {
+	switch {
+	case p.bare:
+		return true
+	case p.quoted:
+		return p.value
+	default:
+		return typedValue(p.value)
+	}
+}
+
+// logfmtKeyPat matches the keys of key=value pairs; it agrees with kvStartPat
+var logfmtKeyPat = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// parseKeyValues parses a string consisting only of whitespace-separated
+// key=value pairs. Keys must match logfmtKeyPat, and values may be
+// double-quoted with Go escapes. If allowBare is set, a key without a value
+// is allowed too. It reports whether the whole string could be parsed.
+func parseKeyValues(s string, allowBare bool) ([]keyValue, bool) {
+	pairs := []keyValue{}
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return pairs, true
+		}
+		end := strings.IndexAny(s, " \t=\"")
+		if end < 0 {
+			end = len(s)
+		}
+		key := s[:end]
+		if !logfmtKeyPat.MatchString(key) {
+			return nil, false
+		}
+		s = s[end:]
+		if s == "" || s[0] == ' ' || s[0] == '\t' {
+			if !allowBare {
+				return nil, false
+			}
+			pairs = append(pairs, keyValue{key: key, bare: true})
+			continue
+		}
+		if s[0] != '=' {
+			return nil, false
+		}
+		s = s[1:]
+		if strings.HasPrefix(s, `"`) {
+			end := quotedLen(s)
+			if end < 0 {
+				return nil, false
+			}
+			v, err := strconv.Unquote(s[:end])
+			if err != nil {
+				return nil, false
+			}
+			pairs = append(pairs, keyValue{key: key, value: v, quoted: true})
+			s = s[end:]
+			if s != "" && s[0] != ' ' && s[0] != '\t' {
+				return nil, false
+			}
+			continue
+		}
+		end = strings.IndexAny(s, " \t")
+		if end < 0 {
+			end = len(s)
+		}
+		pairs = append(pairs, keyValue{key: key, value: s[:end]})
+		s = s[end:]
+	}
+}
+
+// quotedLen returns the length of the double-quoted string at the start of s,
+// including the quotes, or -1 if it isn't terminated.
+func quotedLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// typedValue converts an unquoted value to an int, float64 or bool if it looks
+// like one, and otherwise returns it as a string.
+func typedValue(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if s == "" || !strings.ContainsAny(s[:1], "+-0123456789") {
+		return s
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return s
+}
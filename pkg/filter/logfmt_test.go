@@ -0,0 +1,97 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogfmtInterpreter(t *testing.T) {
+	tests := []struct {
+		name     string
+		coerce   bool
+		input    string
+		wantData string
+		want     map[string]interface{}
+	}{
+		{"empty", false, "", "", map[string]interface{}{}},
+		{"plain text", false, "hello world", "hello world", map[string]interface{}{}},
+		{"simple", false, `ts=2019-04-18T15:18:28.565Z level=info msg="hello world" k=v` + "\n", "", map[string]interface{}{
+			"ts": "2019-04-18T15:18:28.565Z", "level": "info", "msg": "hello world", "k": "v",
+		}},
+		{"escapes", false, `msg="say \"hi\"\n\ttwice" path="C:\\x"`, "", map[string]interface{}{
+			"msg": "say \"hi\"\n\ttwice", "path": `C:\x`,
+		}},
+		{"bare key", false, `level=warn retrying`, `level=warn retrying`, map[string]interface{}{}},
+		{"empty value", false, `level=warn err=`, "", map[string]interface{}{"level": "warn", "err": ""}},
+		{"equals in value", false, `url=http://x/?a=b`, "", map[string]interface{}{"url": "http://x/?a=b"}},
+		{"duplicates", false, `tag=a tag=b tag=c n=1`, "", map[string]interface{}{
+			"tag": []interface{}{"a", "b", "c"}, "n": "1",
+		}},
+		{"no coercion", false, `n=42 f=1.5 ok=true q="7"`, "", map[string]interface{}{
+			"n": "42", "f": "1.5", "ok": "true", "q": "7",
+		}},
+		{"coercion", true, `n=42 f=-1.5 ok=true no=false q="7" s=abc`, "", map[string]interface{}{
+			"n": 42, "f": -1.5, "ok": true, "no": false, "q": "7", "s": "abc",
+		}},
+		{"only bare keys", false, "just some words", "just some words", map[string]interface{}{}},
+		{"unterminated quote", false, `msg="hello`, `msg="hello`, map[string]interface{}{}},
+		{"junk after quote", false, `msg="hello"x k=v`, `msg="hello"x k=v`, map[string]interface{}{}},
+		{"bad escape", false, `msg="\q"`, `msg="\q"`, map[string]interface{}{}},
+		{"missing key", false, `=v k=v`, `=v k=v`, map[string]interface{}{}},
+		{"quote in key", false, `a"b=v`, `a"b=v`, map[string]interface{}{}},
+		{"key with punctuation", false, `a:b=v`, `a:b=v`, map[string]interface{}{}},
+		{"prose", false, `Error: failed to connect to db host=x`, `Error: failed to connect to db host=x`, map[string]interface{}{}},
+		{"url", false, `see https://x.io/?a=b for details`, `see https://x.io/?a=b for details`, map[string]interface{}{}},
+		{"tendermint text", false, `I[2019-04-18|15:18:28.565] Executed block module=state`,
+			`I[2019-04-18|15:18:28.565] Executed block module=state`, map[string]interface{}{}},
+		{"dotted key", false, `http.status=200 _x-y=z`, "", map[string]interface{}{"http.status": "200", "_x-y": "z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := LogfmtInterpreter{Coerce: tt.coerce}
+			data, fields := i.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Equal(t, tt.wantData, string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestLogfmtInterpreterBareKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantData string
+		want     map[string]interface{}
+	}{
+		{"bare key", `level=warn retrying`, "", map[string]interface{}{"level": "warn", "retrying": true}},
+		{"as many bare keys as pairs", `a b=1 c d=2`, "", map[string]interface{}{"a": true, "b": "1", "c": true, "d": "2"}},
+		{"more bare keys than pairs", `failed to connect host=x`, `failed to connect host=x`, map[string]interface{}{}},
+		{"only bare keys", `just some words`, `just some words`, map[string]interface{}{}},
+		{"bad bare key", `level=warn Error:`, `level=warn Error:`, map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := LogfmtInterpreter{BareKeys: true}
+			data, fields := i.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Equal(t, tt.wantData, string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestLogfmtInterpreterMerge(t *testing.T) {
+	i := LogfmtInterpreter{Merge: Merge{Policy: Rename}}
+	_, fields := i.Interpret([]byte(`level=debug msg=hi`), map[string]interface{}{"level": "info"})
+	assert.Equal(t, map[string]interface{}{"level": "info", "dup_level": "debug", "msg": "hi"}, fields)
+}
@@ -0,0 +1,136 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+// CollisionPolicy says what an interpreter does when it wants to set a field
+// that is already in the record.
+type CollisionPolicy int
+
+const (
+	// Overwrite replaces the existing value. This is the default.
+	Overwrite CollisionPolicy = iota
+	// KeepFirst leaves the existing value alone and discards the new one.
+	KeepFirst
+	// Rename keeps the existing value and stores the new one under the same
+	// key with a prefix added.
+	Rename
+	// Nest doesn't merge the interpreter's fields into the record at all, but
+	// puts them all in an object of their own under a single key.
+	Nest
+)
+
+// Defaults for the Merge settings
+const (
+	DefaultRenamePrefix = "dup_"
+	DefaultNestKey      = "payload"
+)
+
+// Merge describes how an interpreter puts the fields it finds into the record.
+// The zero value is the Overwrite policy, which is what interpreters did before
+// there was a choice.
+//
+// With RequiredFieldsInterpreter first in the chain and KeepFirst on the
+// interpreters after it, the required fields can't be overwritten by anything
+// the process writes; with Nest, the process's own fields are kept out of the
+// way entirely.
+type Merge struct {
+	Policy CollisionPolicy
+	// Prefix is added to the key of a colliding field by Rename, as many times
+	// as it takes to find a key that isn't already in use. If it is empty,
+	// DefaultRenamePrefix is used.
+	Prefix string
+	// Key is where Nest puts the interpreter's fields. If it is empty,
+	// DefaultNestKey is used. If the record already has something under Key
+	// that isn't an object, it is left alone and the object is stored as if
+	// by Rename.
+	Key string
+}
+
+// Set stores one field into fields according to the policy, and returns fields.
+func (m Merge) Set(fields map[string]interface{}, k string, v interface{}) map[string]interface{} {
+	switch m.Policy {
+	case KeepFirst:
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	case Rename:
+		fields[m.freeKey(fields, k)] = v
+	case Nest:
+		m.nested(fields)[k] = v
+	default:
+		fields[k] = v
+	}
+	return fields
+}
+
+// Apply stores every field in src into fields according to the policy, and returns fields.
+func (m Merge) Apply(fields map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	if m.Policy == Nest {
+		// copy the object just once, rather than for every field
+		if len(src) > 0 {
+			obj := m.nested(fields)
+			for k, v := range src {
+				obj[k] = v
+			}
+		}
+		return fields
+	}
+	for k, v := range src {
+		fields = m.Set(fields, k, v)
+	}
+	return fields
+}
+
+// freeKey returns k if it isn't in fields, or else k with the prefix added
+// enough times that it isn't.
+func (m Merge) freeKey(fields map[string]interface{}, k string) string {
+	prefix := m.Prefix
+	if prefix == "" {
+		prefix = DefaultRenamePrefix
+	}
+	for {
+		if _, ok := fields[k]; !ok {
+			return k
+		}
+		k = prefix + k
+	}
+}
+
+// nested finds or creates the object that Nest stores fields in. An object that
+// is already in the record is copied, and the copy put in its place, since it may
+// be shared with other records or held by the caller.
+func (m Merge) nested(fields map[string]interface{}) map[string]interface{} {
+	key := m.Key
+	if key == "" {
+		key = DefaultNestKey
+	}
+	prefix := m.Prefix
+	if prefix == "" {
+		prefix = DefaultRenamePrefix
+	}
+	for {
+		existing, ok := fields[key]
+		if !ok {
+			obj := map[string]interface{}{}
+			fields[key] = obj
+			return obj
+		}
+		if obj, ok := existing.(map[string]interface{}); ok {
+			copied := make(map[string]interface{}, len(obj)+1)
+			for k, v := range obj {
+				copied[k] = v
+			}
+			fields[key] = copied
+			return copied
+		}
+		key = prefix + key
+	}
+}
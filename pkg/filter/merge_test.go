@@ -0,0 +1,131 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		merge  Merge
+		fields map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{"overwrite new", Merge{}, map[string]interface{}{}, map[string]interface{}{"level": "info"}},
+		{"overwrite existing", Merge{}, map[string]interface{}{"level": "warn"}, map[string]interface{}{"level": "info"}},
+		{"keepfirst new", Merge{Policy: KeepFirst}, map[string]interface{}{}, map[string]interface{}{"level": "info"}},
+		{"keepfirst existing", Merge{Policy: KeepFirst}, map[string]interface{}{"level": "warn"}, map[string]interface{}{"level": "warn"}},
+		{"rename new", Merge{Policy: Rename}, map[string]interface{}{}, map[string]interface{}{"level": "info"}},
+		{"rename existing", Merge{Policy: Rename}, map[string]interface{}{"level": "warn"},
+			map[string]interface{}{"level": "warn", "dup_level": "info"}},
+		{"rename twice", Merge{Policy: Rename}, map[string]interface{}{"level": "warn", "dup_level": "error"},
+			map[string]interface{}{"level": "warn", "dup_level": "error", "dup_dup_level": "info"}},
+		{"rename prefix", Merge{Policy: Rename, Prefix: "child."}, map[string]interface{}{"level": "warn"},
+			map[string]interface{}{"level": "warn", "child.level": "info"}},
+		{"nest", Merge{Policy: Nest}, map[string]interface{}{"level": "warn"},
+			map[string]interface{}{"level": "warn", "payload": map[string]interface{}{"level": "info"}}},
+		{"nest key", Merge{Policy: Nest, Key: "child"}, map[string]interface{}{},
+			map[string]interface{}{"child": map[string]interface{}{"level": "info"}}},
+		{"nest into existing", Merge{Policy: Nest}, map[string]interface{}{"payload": map[string]interface{}{"a": 1}},
+			map[string]interface{}{"payload": map[string]interface{}{"a": 1, "level": "info"}}},
+		{"nest key taken", Merge{Policy: Nest}, map[string]interface{}{"payload": "x"},
+			map[string]interface{}{"payload": "x", "dup_payload": map[string]interface{}{"level": "info"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.merge.Set(tt.fields, "level", "info")
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMergeApply(t *testing.T) {
+	src := map[string]interface{}{"level": "info", "msg": "hi"}
+	tests := []struct {
+		name  string
+		merge Merge
+		want  map[string]interface{}
+	}{
+		{"overwrite", Merge{}, map[string]interface{}{"level": "info", "msg": "hi", "module": "x"}},
+		{"keepfirst", Merge{Policy: KeepFirst}, map[string]interface{}{"level": "warn", "msg": "hi", "module": "x"}},
+		{"rename", Merge{Policy: Rename}, map[string]interface{}{"level": "warn", "dup_level": "info", "msg": "hi", "module": "x"}},
+		{"nest", Merge{Policy: Nest}, map[string]interface{}{"level": "warn", "module": "x",
+			"payload": map[string]interface{}{"level": "info", "msg": "hi"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]interface{}{"level": "warn", "module": "x"}
+			got := tt.merge.Apply(fields, src)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMergeNestCopies(t *testing.T) {
+	// the same object in two records, as RequiredFieldsInterpreter would leave it
+	shared := map[string]interface{}{"a": 1}
+	first := map[string]interface{}{"payload": shared}
+	second := map[string]interface{}{"payload": shared}
+
+	m := Merge{Policy: Nest}
+	first = m.Set(first, "b", 2)
+	second = m.Apply(second, map[string]interface{}{"c": 3, "d": 4})
+	assert.Equal(t, map[string]interface{}{"a": 1}, shared)
+	assert.Equal(t, map[string]interface{}{"payload": map[string]interface{}{"a": 1, "b": 2}}, first)
+	assert.Equal(t, map[string]interface{}{"payload": map[string]interface{}{"a": 1, "c": 3, "d": 4}}, second)
+}
+
+func TestMergeInterpreterChain(t *testing.T) {
+	required := RequiredFieldsInterpreter{Defaults: map[string]interface{}{"level": "info", "module": "node"}}
+	input := []byte(`{"level":"debug","msg":"hello"}`)
+	tests := []struct {
+		name  string
+		terps []Interpreter
+		want  map[string]interface{}
+	}{
+		{"required first, child wins", []Interpreter{required, JSONInterpreter{}},
+			map[string]interface{}{"level": "debug", "module": "node", "msg": "hello"}},
+		{"required first, keepfirst", []Interpreter{required, JSONInterpreter{Merge: Merge{Policy: KeepFirst}}},
+			map[string]interface{}{"level": "info", "module": "node", "msg": "hello"}},
+		{"required last, keepfirst", []Interpreter{JSONInterpreter{}, RequiredFieldsInterpreter{
+			Defaults: required.Defaults, Merge: Merge{Policy: KeepFirst}}},
+			map[string]interface{}{"level": "debug", "module": "node", "msg": "hello"}},
+		{"required first, nested", []Interpreter{required, JSONInterpreter{Merge: Merge{Policy: Nest}}},
+			map[string]interface{}{"level": "info", "module": "node",
+				"payload": map[string]interface{}{"level": "debug", "msg": "hello"}}},
+		{"last chance renamed", []Interpreter{required, RequiredFieldsInterpreter{Defaults: map[string]interface{}{"_other": "x"}},
+			LastChanceInterpreter{Merge: Merge{Policy: Rename}}},
+			map[string]interface{}{"level": "info", "module": "node", "_other": "x", "dup__other": string(input)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte{}, input...)
+			fields := map[string]interface{}{}
+			for _, i := range tt.terps {
+				data, fields = i.Interpret(data, fields)
+			}
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestMergeRedisKeepFirst(t *testing.T) {
+	r := RedisInterpreter{Merge: Merge{Policy: KeepFirst}}
+	fields := map[string]interface{}{"level": "error"}
+	_, fields = r.Interpret([]byte("1:M 18 Apr 2019 15:18:28.565 * Ready to accept connections"), fields)
+	assert.Equal(t, "error", fields["level"])
+	assert.Equal(t, "master", fields["role"])
+	assert.Equal(t, "Ready to accept connections", fields["msg"])
+}
@@ -0,0 +1,97 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"context"
+	"time"
+
+	"github.com/ndau/writers/pkg/bufio"
+	"github.com/ndau/writers/pkg/ringbuffer"
+)
+
+// ShutdownMode controls what a Filter does with the data it has been given
+// but not yet processed when its context is cancelled.
+type ShutdownMode int
+
+const (
+	// DropPending shuts the Filter's goroutine down immediately and discards
+	// anything that hasn't yet been sent to the output.
+	DropPending ShutdownMode = iota
+	// DrainPending stops accepting writes but sends everything that has already
+	// been written through the interpreters to the output before shutting down,
+	// exactly as Close() does.
+	DrainPending
+)
+
+// Option configures a Filter constructed by New or NewWithSink.
+type Option func(*Filter)
+
+// WithInterpreters sets the interpreters, in order, that each token is passed through.
+func WithInterpreters(terps ...Interpreter) Option {
+	return func(f *Filter) {
+		f.Interpreters = terps
+	}
+}
+
+// WithSplitterFactory makes the Filter call factory for a new split function for
+// each of its sources, in place of the one passed to New or NewWithSink. Splitters
+// that keep state between calls, like those made by bufio.Multiline or GoPanicSplit,
+// must be supplied this way if the Filter has more than one source.
+func WithSplitterFactory(factory func() bufio.SplitFunc) Option {
+	return func(f *Filter) {
+		f.newSplitter = factory
+	}
+}
+
+// WithDone sets a done channel (which may be nil) that will shut down the Filter's
+// goroutine when closed, discarding anything not yet processed.
+func WithDone(done chan struct{}) Option {
+	return func(f *Filter) {
+		f.done = done
+	}
+}
+
+// WithContext ties the Filter's lifetime to ctx. When ctx is cancelled the Filter
+// stops accepting writes and then either drops or drains whatever it is still
+// holding, according to mode. Use Wait() to find out when it has finished.
+func WithContext(ctx context.Context, mode ShutdownMode) Option {
+	return func(f *Filter) {
+		f.ctx = ctx
+		f.mode = mode
+	}
+}
+
+// WithBufferLimit caps the number of bytes the Filter will hold waiting for its
+// goroutine to catch up, and sets what Write does when it gets there: block the
+// writer, drop the newest or oldest data, or fail the Write with ringbuffer.ErrFull.
+// Whenever data has been dropped, the Filter sends a record to its sink saying how
+// much was lost, after the records made from the data written before it.
+//
+// The scanner holds on to at most one token on top of this, so a Filter's memory use
+// is bounded by limit plus bufio.MaxScanTokenSize for each of its sources.
+func WithBufferLimit(limit int, policy ringbuffer.OverflowPolicy) Option {
+	return func(f *Filter) {
+		f.limit = limit
+		f.policy = policy
+	}
+}
+
+// WithIdleTimeout makes the Filter stop waiting for the rest of a token once no
+// data has arrived for d. The splitter is given the partial data as if it were
+// at the end of the input, so that a prompt without a newline, or anything else
+// that isn't followed by the end of a token, is sent to the sink anyway. After
+// that, scanning carries on as usual.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(f *Filter) {
+		f.idle = d
+	}
+}
@@ -0,0 +1,176 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+
+	"github.com/ndau/writers/pkg/bufio"
+)
+
+// redisPrefixPat matches the start of a line that redis logged normally,
+// as opposed to one that it wrote raw, like the lines of its banner
+var redisPrefixPat = regexp.MustCompile(`^(?:[0-9]+:[XCSMR]|\[[0-9]+\]) `)
+
+// Defaults for the limits RedisSplit puts on a block. They keep a long run of
+// output that isn't from redis well short of bufio.MaxScanTokenSize, which would
+// stop the scanner for good.
+const (
+	DefaultRedisBlockLines = 100
+	DefaultRedisBlockBytes = 16 * 1024
+)
+
+// RedisSplit is a split function for redis logs. Lines that redis logged with
+// its usual pid:role timestamp prefix are returned one at a time, like ScanLines
+// does; consecutive lines without it, like the lines of the ASCII-art banner
+// that redis prints at startup, are returned together as a single token. Such a
+// block ends at the next prefixed line, at an empty line, or at the end of the
+// data, or early if it reaches DefaultRedisBlockLines lines or adding the next
+// line would make it more than DefaultRedisBlockBytes long. The rest of the
+// lines start the next block.
+func RedisSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return redisSplit(data, atEOF, DefaultRedisBlockLines, DefaultRedisBlockBytes)
+}
+
+// NewRedisSplit returns a split function that works like RedisSplit, but with
+// other limits on the blocks. As for bufio.Multiline, a block ends early if it
+// has maxLines lines, or if adding the next line would make it more than
+// maxBytes long; zero means no limit.
+func NewRedisSplit(maxLines, maxBytes int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		return redisSplit(data, atEOF, maxLines, maxBytes)
+	}
+}
+
+// redisSplit is RedisSplit with the given limits.
+func redisSplit(data []byte, atEOF bool, maxLines, maxBytes int) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		if atEOF {
+			return len(data), dropCR(data), nil
+		}
+		return 0, nil, nil
+	}
+	first := dropCR(data[:end])
+	if len(first) == 0 || redisPrefixPat.Match(first) {
+		return end + 1, first, nil
+	}
+
+	// we're in a block; find where it ends
+	lines := [][]byte{first}
+	size := len(first)
+	pos := end + 1
+	for maxLines <= 0 || len(lines) < maxLines {
+		next := bytes.IndexByte(data[pos:], '\n')
+		lineEnd := pos + next + 1
+		if next < 0 {
+			if !atEOF {
+				// we can't tell if the block is finished yet
+				return 0, nil, nil
+			}
+			next = len(data) - pos
+			lineEnd = len(data)
+		}
+		line := dropCR(data[pos : pos+next])
+		if len(line) == 0 || redisPrefixPat.Match(line) {
+			break
+		}
+		if maxBytes > 0 && size+1+len(line) > maxBytes {
+			break
+		}
+		lines = append(lines, line)
+		size += 1 + len(line)
+		pos = lineEnd
+	}
+	return pos, bytes.Join(lines, []byte{'\n'}), nil
+}
+
+// dropCR drops a terminal \r from the data.
+func dropCR(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] == '\r' {
+		return data[0 : len(data)-1]
+	}
+	return data
+}
+
+// redisEvents identify well-known redis messages
+var redisEvents = []struct {
+	pattern *regexp.Regexp
+	event   string
+}{
+	{regexp.MustCompile(`Redis is starting`), "starting"},
+	{regexp.MustCompile(`^Server (?:initialized|started)`), "initialized"},
+	{regexp.MustCompile(`^(?:The server is now )?[Rr]eady to accept connections`), "ready"},
+	{regexp.MustCompile(`^DB loaded from disk`), "rdb_loaded"},
+	{regexp.MustCompile(`^DB loaded from append only file`), "aof_loaded"},
+	{regexp.MustCompile(`^\d+ changes in \d+ seconds\. Saving`), "rdb_save_triggered"},
+	{regexp.MustCompile(`^Background saving started`), "rdb_bgsave_started"},
+	{regexp.MustCompile(`^Background saving terminated with success`), "rdb_bgsave_done"},
+	{regexp.MustCompile(`^Background saving error`), "rdb_bgsave_failed"},
+	{regexp.MustCompile(`^DB saved on disk`), "rdb_saved"},
+	{regexp.MustCompile(`^Background append only file rewriting started`), "aof_rewrite_started"},
+	{regexp.MustCompile(`^Background AOF rewrite (?:terminated|finished) (?:with success|successfully)`), "aof_rewrite_done"},
+	{regexp.MustCompile(`^Connecting to MASTER`), "replication_connecting"},
+	{regexp.MustCompile(`^MASTER <-> (?:SLAVE|REPLICA) sync started`), "replication_sync_started"},
+	{regexp.MustCompile(`^MASTER <-> (?:SLAVE|REPLICA) sync: Finished with success`), "replication_sync_done"},
+	{regexp.MustCompile(`^(?:Slave|Replica) \S+ asks for synchronization`), "replication_sync_requested"},
+	{regexp.MustCompile(`^Synchronization with (?:slave|replica) \S+ succeeded`), "replication_sync_succeeded"},
+	{regexp.MustCompile(`^(?:Received SIG\w+|User requested) shutdown`), "shutdown_requested"},
+	{regexp.MustCompile(`^Redis is now ready to exit`), "exit"},
+}
+
+// redisEvent returns the event for a redis message, or "" if it isn't one we know.
+func redisEvent(msg string) string {
+	for _, e := range redisEvents {
+		if e.pattern.MatchString(msg) {
+			return e.event
+		}
+	}
+	return ""
+}
+
+// patterns for the information in the redis banner
+var (
+	redisVersionPat = regexp.MustCompile(`Redis (\d+\.\d+\.\d+)`)
+	redisModePat    = regexp.MustCompile(`Running in (\w+) mode`)
+	redisPortPat    = regexp.MustCompile(`Port: (\d+)`)
+	redisPIDPat     = regexp.MustCompile(`PID: (\d+)`)
+	redisLogoPat    = regexp.MustCompile(`_\._`)
+)
+
+// redisBlock returns the fields for a block of text that redis wrote raw; if
+// the block is the banner, that is the event and the information in it.
+func redisBlock(s string) map[string]interface{} {
+	found := map[string]interface{}{}
+	version := redisVersionPat.FindStringSubmatch(s)
+	if version == nil || !redisLogoPat.MatchString(s) {
+		return found
+	}
+	found["event"] = "banner"
+	found["version"] = version[1]
+	if m := redisModePat.FindStringSubmatch(s); m != nil {
+		found["mode"] = m[1]
+	}
+	if m := redisPortPat.FindStringSubmatch(s); m != nil {
+		if port, err := strconv.Atoi(m[1]); err == nil {
+			found["port"] = port
+		}
+	}
+	if m := redisPIDPat.FindStringSubmatch(s); m != nil {
+		found["pid"] = m[1]
+	}
+	return found
+}
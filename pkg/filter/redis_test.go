@@ -0,0 +1,176 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ndau/writers/pkg/bufio"
+	"github.com/ndau/writers/pkg/ringbuffer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleRedisBanner = "66940:C 18 Apr 2019 15:18:28.565 # Configuration loaded\n" +
+	"                _._                                                  \n" +
+	"           _.-``__ ''-._                                             \n" +
+	"      _.-``    `.  `_.  ''-._           Redis 5.0.4 (00000000/0) 64 bit\n" +
+	"  .-`` .-```.  ```\\/    _.,_ ''-._                                   \n" +
+	" (    '      ,       .-`  | `,    )     Running in standalone mode\n" +
+	" |`-._`-...-` __...-.``-._|'` _.-'|     Port: 6380\n" +
+	" |    `-._   `._    /     _.-'    |     PID: 66940\n" +
+	"  `-._    `-._  `-./  _.-'    _.-'                                   \n" +
+	"              `-.__.-'                                               \n" +
+	"\n" +
+	"66940:M 18 Apr 2019 15:18:28.567 # Server initialized\n" +
+	"66940:M 18 Apr 2019 15:18:28.569 * Ready to accept connections\n"
+
+func splitAll(t *testing.T, split bufio.SplitFunc, input string) []string {
+	cbuf := ringbuffer.New(4096)
+	_, err := cbuf.Write([]byte(input))
+	require.NoError(t, err)
+	require.NoError(t, cbuf.Close())
+	scanner := bufio.NewScanner(cbuf, split)
+	tokens := []string{}
+	for scanner.Scan() {
+		tokens = append(tokens, string(scanner.Bytes()))
+	}
+	require.NoError(t, scanner.Err())
+	return tokens
+}
+
+func TestRedisSplit(t *testing.T) {
+	tokens := splitAll(t, RedisSplit, sampleRedisBanner)
+	require.Equal(t, 5, len(tokens), "%q", tokens)
+	assert.Equal(t, "66940:C 18 Apr 2019 15:18:28.565 # Configuration loaded", tokens[0])
+	assert.True(t, strings.HasPrefix(tokens[1], "                _._"))
+	assert.Equal(t, 9, strings.Count(tokens[1], "\n")+1)
+	assert.Equal(t, "", tokens[2])
+	assert.Equal(t, "66940:M 18 Apr 2019 15:18:28.567 # Server initialized", tokens[3])
+
+	// blocks end at the next prefixed line, even without an empty line, and at EOF
+	tokens = splitAll(t, RedisSplit, "a\r\nb\n[123] 18 Apr 15:18:28 * hi\r\nc\nd")
+	assert.Equal(t, []string{"a\nb", "[123] 18 Apr 15:18:28 * hi", "c\nd"}, tokens)
+}
+
+func TestRedisSplitWaitsForBlock(t *testing.T) {
+	data := []byte("  _._\n  Redis 5.0.4\n")
+	advance, token, err := RedisSplit(data, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, advance)
+	assert.Nil(t, token)
+
+	advance, token, err = RedisSplit(data, true)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), advance)
+	assert.Equal(t, "  _._\n  Redis 5.0.4", string(token))
+}
+
+func TestRedisSplitLimits(t *testing.T) {
+	input := "a\nb\nc\nd\ne\n[1] 18 Apr 15:18:28 * hi\n"
+	tokens := splitAll(t, NewRedisSplit(2, 0), input)
+	assert.Equal(t, []string{"a\nb", "c\nd", "e", "[1] 18 Apr 15:18:28 * hi"}, tokens)
+
+	// "a\nb\nc" is 5 bytes
+	tokens = splitAll(t, NewRedisSplit(0, 5), input)
+	assert.Equal(t, []string{"a\nb\nc", "d\ne", "[1] 18 Apr 15:18:28 * hi"}, tokens)
+
+	// a block is emitted once it's full, without waiting for its end
+	advance, token, err := NewRedisSplit(2, 0)([]byte("a\nb\nc"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, advance)
+	assert.Equal(t, "a\nb", string(token))
+}
+
+func TestRedisSplitLongBlock(t *testing.T) {
+	// far more output without the redis prefix than a scanner can hold
+	line := strings.Repeat("x", 99) + "\n"
+	input := strings.Repeat(line, 2*bufio.MaxScanTokenSize/len(line))
+	tokens := 0
+	f := New(RedisSplit, func(map[string]interface{}) { tokens++ })
+	f.Write([]byte(input))
+	assert.NoError(t, f.Close())
+	assert.Equal(t, 2*bufio.MaxScanTokenSize/len(line)/DefaultRedisBlockLines+1, tokens)
+}
+
+func TestRedisInterpreterBanner(t *testing.T) {
+	r := RedisInterpreter{}
+	var records []map[string]interface{}
+	for _, token := range splitAll(t, RedisSplit, sampleRedisBanner) {
+		data, fields := r.Interpret([]byte(token), map[string]interface{}{})
+		assert.Empty(t, data)
+		if len(fields) > 0 {
+			records = append(records, fields)
+		}
+	}
+	require.Equal(t, 4, len(records))
+	banner := records[1]
+	assert.Equal(t, "banner", banner["event"])
+	assert.Equal(t, "5.0.4", banner["version"])
+	assert.Equal(t, "standalone", banner["mode"])
+	assert.Equal(t, 6380, banner["port"])
+	assert.Equal(t, "66940", banner["pid"])
+	assert.True(t, strings.HasPrefix(banner["_txt"].(string), "                _._"))
+	assert.Equal(t, "initialized", records[2]["event"])
+	assert.Equal(t, "ready", records[3]["event"])
+}
+
+func TestRedisInterpreterFormats(t *testing.T) {
+	clock := func() time.Time { return time.Date(2019, 4, 20, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name       string
+		useReplica bool
+		input      string
+		want       map[string]interface{}
+	}{
+		{"modern", false, "66940:S 18 Apr 2019 15:18:28.565 * MASTER <-> REPLICA sync started", map[string]interface{}{
+			"pid": "66940", "role": "slave", "timestamp": "2019-04-18T15:18:28.565Z", "level": "info",
+			"msg": "MASTER <-> REPLICA sync started", "event": "replication_sync_started",
+		}},
+		{"replica naming", true, "66940:S 18 Apr 2019 15:18:28.565 * MASTER <-> REPLICA sync: Finished with success", map[string]interface{}{
+			"pid": "66940", "role": "replica", "timestamp": "2019-04-18T15:18:28.565Z", "level": "info",
+			"msg": "MASTER <-> REPLICA sync: Finished with success", "event": "replication_sync_done",
+		}},
+		{"R role", false, "7:R 18 Apr 2019 15:18:28.565 * Connecting to MASTER 10.0.0.1:6379", map[string]interface{}{
+			"pid": "7", "role": "replica", "timestamp": "2019-04-18T15:18:28.565Z", "level": "info",
+			"msg": "Connecting to MASTER 10.0.0.1:6379", "event": "replication_connecting",
+		}},
+		{"no year", false, "7:M 18 Apr 15:18:28.565 * DB saved on disk", map[string]interface{}{
+			"pid": "7", "role": "master", "timestamp": "2019-04-18T15:18:28.565Z", "level": "info",
+			"msg": "DB saved on disk", "event": "rdb_saved",
+		}},
+		{"no year last year", false, "7:M 31 Dec 23:59:59.000 # Background saving error", map[string]interface{}{
+			"pid": "7", "role": "master", "timestamp": "2018-12-31T23:59:59Z", "level": "warn",
+			"msg": "Background saving error", "event": "rdb_bgsave_failed",
+		}},
+		{"old format", false, "[4018] 14 Nov 07:01:22 * Background append only file rewriting started by pid 4019", map[string]interface{}{
+			"pid": "4018", "timestamp": "2018-11-14T07:01:22Z", "level": "info",
+			"msg": "Background append only file rewriting started by pid 4019", "event": "aof_rewrite_started",
+		}},
+		{"no event", false, "7:M 18 Apr 2019 15:18:28.565 - Client closed connection", map[string]interface{}{
+			"pid": "7", "role": "master", "timestamp": "2019-04-18T15:18:28.565Z", "level": "debug",
+			"msg": "Client closed connection",
+		}},
+		{"bad date", false, "7:M 99 Foo 2019 15:18:28.565 * hi", map[string]interface{}{
+			"pid": "7", "role": "master", "timestamp": "99 Foo 2019 15:18:28.565", "level": "info", "msg": "hi",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := RedisInterpreter{UseReplica: tt.useReplica, Clock: clock}
+			data, fields := r.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Empty(t, data)
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conversion turns the text captured by a regex group into a typed value.
+type Conversion func(string) (interface{}, error)
+
+// ToInt is a Conversion to int
+func ToInt(s string) (interface{}, error) {
+	return strconv.Atoi(s)
+}
+
+// ToFloat is a Conversion to float64
+func ToFloat(s string) (interface{}, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+// ToBool is a Conversion to bool; it accepts the same values as strconv.ParseBool
+func ToBool(s string) (interface{}, error) {
+	return strconv.ParseBool(s)
+}
+
+// ToDuration is a Conversion to time.Duration; it accepts the same values as
+// time.ParseDuration
+func ToDuration(s string) (interface{}, error) {
+	return time.ParseDuration(s)
+}
+
+// ToTime returns a Conversion that parses a time with the given layout and
+// formats it as RFC3339Nano, like the timestamps set by other interpreters.
+func ToTime(layout string) Conversion {
+	return func(s string) (interface{}, error) {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(time.RFC3339Nano), nil
+	}
+}
+
+// RegexInterpreter parses text with regular expressions, storing the text
+// captured by each named group in the field with the group's name. The
+// patterns are tried in order, and the first one that matches is used. Groups
+// without names, and groups that don't take part in the match, are ignored.
+//
+// Values holds maps for groups whose text should be replaced by another value,
+// like the symbols Redis uses for log levels. Text that is in a group's map is
+// replaced; otherwise, if the group has a Conversion in Types, the text is
+// converted by it. If there is no map entry or conversion, or the conversion
+// fails, the field is set to the text itself.
+//
+// If any pattern matches, the data is consumed. If none do, the data is passed
+// on unchanged, unless ConsumeUnmatched is set, in which case it is stored in
+// UnmatchedKey (or _txt, if that is empty) and consumed.
+// Merge controls what happens to fields that are already in the record.
+type RegexInterpreter struct {
+	Patterns         []*regexp.Regexp
+	Types            map[string]Conversion
+	Values           map[string]map[string]interface{}
+	ConsumeUnmatched bool
+	UnmatchedKey     string
+	Merge            Merge
+}
+
+var _ Interpreter = RegexInterpreter{}
+
+// NewRegexInterpreter compiles the patterns for a RegexInterpreter. It returns
+// an error if any of them is invalid or has no named groups.
+func NewRegexInterpreter(patterns ...string) (RegexInterpreter, error) {
+	i := RegexInterpreter{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return i, err
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				named = true
+			}
+		}
+		if !named {
+			return i, fmt.Errorf("pattern %q has no named groups", p)
+		}
+		i.Patterns = append(i.Patterns, re)
+	}
+	return i, nil
+}
+
+// Interpret implements Interpreter for RegexInterpreter
+func (i RegexInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	s := strings.TrimRight(string(data), "\r\n")
+	for _, re := range i.Patterns {
+		loc := re.FindStringSubmatchIndex(s)
+		if loc == nil {
+			continue
+		}
+		found := map[string]interface{}{}
+		for n, name := range re.SubexpNames() {
+			if name == "" || loc[2*n] < 0 {
+				continue
+			}
+			found[name] = i.value(name, s[loc[2*n]:loc[2*n+1]])
+		}
+		return nil, i.Merge.Apply(fields, found)
+	}
+	if i.ConsumeUnmatched && len(data) > 0 {
+		key := i.UnmatchedKey
+		if key == "" {
+			key = "_txt"
+		}
+		return nil, i.Merge.Set(fields, key, s)
+	}
+	return data, fields
+}
+
+// value works out the value of the field for a group.
+func (i RegexInterpreter) value(name, text string) interface{} {
+	if v, ok := i.Values[name][text]; ok {
+		return v
+	}
+	if convert, ok := i.Types[name]; ok && convert != nil {
+		if v, err := convert(text); err == nil {
+			return v
+		}
+	}
+	return text
+}
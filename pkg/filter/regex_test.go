@@ -0,0 +1,107 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redisRegex does most of what RedisInterpreter does
+func redisRegex(t *testing.T) RegexInterpreter {
+	i, err := NewRegexInterpreter(
+		`^(?P<pid>\d+):(?P<role>[XCSM]) (?P<timestamp>\d\d [A-Z][a-z]{2} \d{4} \d\d:\d\d:\d\d\.\d{3}) (?P<level>[.\-*#]) (?P<msg>.*)$`,
+	)
+	require.NoError(t, err)
+	i.Types = map[string]Conversion{
+		"pid":       ToInt,
+		"timestamp": ToTime("02 Jan 2006 15:04:05.000"),
+	}
+	i.Values = map[string]map[string]interface{}{
+		"role":  {"X": "sentinel", "C": "child", "S": "slave", "M": "master"},
+		"level": {".": "debug", "-": "debug", "*": "info", "#": "warn"},
+	}
+	return i
+}
+
+func TestRegexInterpreter(t *testing.T) {
+	tests := []struct {
+		name     string
+		consume  bool
+		input    string
+		wantData string
+		want     map[string]interface{}
+	}{
+		{"redis", false, "66940:C 18 Apr 2019 15:18:28.565 # Configuration loaded\n", "", map[string]interface{}{
+			"pid": 66940, "role": "child", "timestamp": "2019-04-18T15:18:28.565Z", "level": "warn", "msg": "Configuration loaded",
+		}},
+		{"pass on", false, "hello", "hello", map[string]interface{}{}},
+		{"consume", true, "hello\n", "", map[string]interface{}{"_txt": "hello"}},
+		{"consume nothing", true, "", "", map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := redisRegex(t)
+			i.ConsumeUnmatched = tt.consume
+			data, fields := i.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Equal(t, tt.wantData, string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestRegexInterpreterConversions(t *testing.T) {
+	i, err := NewRegexInterpreter(
+		`^took (?P<took>\S+) ok=(?P<ok>\S+) ratio=(?P<ratio>\S+)(?: at (?P<at>.+))?$`,
+		`^(?P<count>\d+) things$`,
+	)
+	require.NoError(t, err)
+	i.Types = map[string]Conversion{
+		"took":  ToDuration,
+		"ok":    ToBool,
+		"ratio": ToFloat,
+		"at":    ToTime(time.RFC1123),
+		"count": ToInt,
+	}
+	i.UnmatchedKey = "unparsed"
+	i.ConsumeUnmatched = true
+
+	tests := []struct {
+		input string
+		want  map[string]interface{}
+	}{
+		{"took 1.5s ok=true ratio=0.25 at Mon, 02 Jan 2006 15:04:05 UTC", map[string]interface{}{
+			"took": 1500 * time.Millisecond, "ok": true, "ratio": 0.25, "at": "2006-01-02T15:04:05Z",
+		}},
+		{"took forever ok=maybe ratio=x", map[string]interface{}{
+			"took": "forever", "ok": "maybe", "ratio": "x",
+		}},
+		{"42 things", map[string]interface{}{"count": 42}},
+		{"nothing", map[string]interface{}{"unparsed": "nothing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			data, fields := i.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Empty(t, data)
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestNewRegexInterpreterErrors(t *testing.T) {
+	_, err := NewRegexInterpreter(`(?P<a>x`)
+	assert.Error(t, err)
+	_, err = NewRegexInterpreter(`(?P<a>x)`, `(x)`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/ndau/writers/pkg/encoder"
+)
+
+// Sink is the destination for the records produced by a Filter.
+//
+// The Filter calls Emit once for each record, Flush whenever it has processed
+// everything that has been written to it so far, and Close once, when its
+// goroutine exits. Errors from Emit don't stop the Filter; the first error it
+// sees from any of these methods is reported by the Filter's Wait and Close.
+type Sink interface {
+	Emit(fields map[string]interface{}) error
+	Flush() error
+	Close() error
+}
+
+// OutputFunc adapts an ordinary output function to the Sink interface.
+// Its Flush and Close do nothing.
+type OutputFunc func(map[string]interface{})
+
+var _ Sink = OutputFunc(nil)
+
+// Emit implements Sink for OutputFunc
+func (o OutputFunc) Emit(fields map[string]interface{}) error {
+	o(fields)
+	return nil
+}
+
+// Flush implements Sink for OutputFunc
+func (OutputFunc) Flush() error {
+	return nil
+}
+
+// Close implements Sink for OutputFunc
+func (OutputFunc) Close() error {
+	return nil
+}
+
+// writerSink buffers records encoded by its encoder and writes them to
+// an io.Writer. It is safe to share between Filters.
+type writerSink struct {
+	mutex sync.Mutex
+	w     *bufio.Writer
+	enc   encoder.Encoder
+}
+
+var _ Sink = (*writerSink)(nil)
+
+// NewEncoderSink constructs a Sink that uses enc to write each record to w.
+// Output is buffered until the sink is flushed. Closing the sink flushes it, but does
+// not close w.
+func NewEncoderSink(w io.Writer, enc encoder.Encoder) Sink {
+	return &writerSink{w: bufio.NewWriter(w), enc: enc}
+}
+
+// NewJSONSink constructs a Sink that writes each record to w as a single line of JSON,
+// with its keys in a stable order.
+// Output is buffered until the sink is flushed. Closing the sink flushes it, but does
+// not close w.
+func NewJSONSink(w io.Writer) Sink {
+	return NewEncoderSink(w, encoder.JSON{})
+}
+
+// NewLogfmtSink constructs a Sink that writes each record to w as a line of
+// space-separated key=value pairs, with its keys in a stable order.
+// Output is buffered until the sink is flushed. Closing the sink flushes it, but does
+// not close w.
+func NewLogfmtSink(w io.Writer) Sink {
+	return NewEncoderSink(w, encoder.Logfmt{})
+}
+
+// NewConsoleSink constructs a Sink that writes each record to w in a form meant
+// for people to read: timestamp, level, module and message in aligned columns,
+// followed by the remaining fields as key=value pairs, with very long values
+// truncated. If color is set, it uses ANSI colors to highlight levels and keys.
+// Use NewEncoderSink with an encoder.Console for more control over the format.
+// Output is buffered until the sink is flushed. Closing the sink flushes it, but does
+// not close w.
+func NewConsoleSink(w io.Writer, color bool) Sink {
+	return NewEncoderSink(w, &encoder.Console{
+		Color:        color,
+		Align:        true,
+		MessageWidth: 40,
+		MaxValueLen:  120,
+	})
+}
+
+// Emit implements Sink for writerSink
+func (s *writerSink) Emit(fields map[string]interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.enc.Encode(s.w, fields)
+}
+
+// Flush implements Sink for writerSink
+func (s *writerSink) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.w.Flush()
+}
+
+// Close implements Sink for writerSink
+func (s *writerSink) Close() error {
+	return s.Flush()
+}
+
+// fanOut is a Sink that sends everything to several other Sinks.
+type fanOut []Sink
+
+var _ Sink = fanOut(nil)
+
+// FanOut constructs a Sink that passes every call on to each of sinks, in order.
+// All of the sinks are always called; the first error any of them returns is
+// the result.
+func FanOut(sinks ...Sink) Sink {
+	return fanOut(sinks)
+}
+
+// Emit implements Sink for fanOut
+func (f fanOut) Emit(fields map[string]interface{}) error {
+	return f.each(func(s Sink) error { return s.Emit(fields) })
+}
+
+// Flush implements Sink for fanOut
+func (f fanOut) Flush() error {
+	return f.each(Sink.Flush)
+}
+
+// Close implements Sink for fanOut
+func (f fanOut) Close() error {
+	return f.each(Sink.Close)
+}
+
+func (f fanOut) each(call func(Sink) error) error {
+	var first error
+	for _, s := range f {
+		if err := call(s); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,127 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ndau/writers/pkg/bufio"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingSink remembers everything that happens to it, and can be told to fail
+type recordingSink struct {
+	records []map[string]interface{}
+	flushes int
+	closes  int
+	err     error
+}
+
+func (r *recordingSink) Emit(fields map[string]interface{}) error {
+	r.records = append(r.records, fields)
+	return r.err
+}
+
+func (r *recordingSink) Flush() error {
+	r.flushes++
+	return r.err
+}
+
+func (r *recordingSink) Close() error {
+	r.closes++
+	return r.err
+}
+
+func TestJSONSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := NewJSONSink(buf)
+	assert.Nil(t, s.Emit(map[string]interface{}{"b": 2, "a": "one"}))
+	assert.Nil(t, s.Emit(map[string]interface{}{"c": []interface{}{1, "x"}}))
+	// nothing is written until we flush
+	assert.Zero(t, buf.Len())
+	assert.Nil(t, s.Close())
+	assert.Equal(t, "{\"a\":\"one\",\"b\":2}\n{\"c\":[1,\"x\"]}\n", buf.String())
+}
+
+func TestJSONSinkOrder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := NewJSONSink(buf)
+	assert.Nil(t, s.Emit(map[string]interface{}{"b": 2, "msg": "hi", "level": "info", "a": 1}))
+	assert.Nil(t, s.Flush())
+	assert.Equal(t, "{\"level\":\"info\",\"msg\":\"hi\",\"a\":1,\"b\":2}\n", buf.String())
+}
+
+func TestLogfmtSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := NewLogfmtSink(buf)
+	assert.Nil(t, s.Emit(map[string]interface{}{
+		"msg":   "hello world",
+		"level": "info",
+		"n":     17,
+		"empty": "",
+		"eq":    "a=b",
+		"obj":   map[string]interface{}{"x": 1},
+		"none":  nil,
+	}))
+	assert.Nil(t, s.Flush())
+	assert.Equal(t, `level=info msg="hello world" empty="" eq="a=b" n=17 none= obj="{\"x\":1}"`+"\n", buf.String())
+}
+
+func TestFanOut(t *testing.T) {
+	failure := errors.New("nope")
+	a := &recordingSink{}
+	b := &recordingSink{err: failure}
+	c := &recordingSink{}
+	s := FanOut(a, b, c)
+
+	rec := map[string]interface{}{"a": 1}
+	assert.Equal(t, failure, s.Emit(rec))
+	assert.Equal(t, failure, s.Flush())
+	assert.Equal(t, failure, s.Close())
+	for _, r := range []*recordingSink{a, b, c} {
+		assert.Equal(t, []map[string]interface{}{rec}, r.records)
+		assert.Equal(t, 1, r.flushes)
+		assert.Equal(t, 1, r.closes)
+	}
+}
+
+func TestFilterWithSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	filter := NewWithSink(bufio.ScanLines, NewJSONSink(buf),
+		WithInterpreters(LastChanceInterpreter{}),
+	)
+	filter.Write([]byte("one\ntwo\n"))
+	assert.Nil(t, filter.Close())
+	assert.Equal(t, "{\"_other\":\"one\"}\n{\"_other\":\"two\"}\n", buf.String())
+}
+
+func TestFilterSinkError(t *testing.T) {
+	failure := errors.New("nope")
+	sink := &recordingSink{err: failure}
+	filter := NewWithSink(bufio.ScanLines, sink, WithInterpreters(LastChanceInterpreter{}))
+	filter.Write([]byte("one\ntwo\n"))
+	assert.Equal(t, failure, filter.Close())
+	// errors don't stop the records from flowing
+	assert.Equal(t, 2, len(sink.records))
+	assert.Equal(t, 1, sink.closes)
+}
+
+func TestConsoleSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	filter := NewWithSink(JSONSplit, NewConsoleSink(buf, false),
+		WithInterpreters(JSONInterpreter{}, NewTendermintInterpreter(), LastChanceInterpreter{}),
+	)
+	filter.Write([]byte(`{"_msg":"Executed block","height":2,"level":"info","module":"state"}`))
+	assert.Nil(t, filter.Close())
+	assert.Equal(t, "INFO  [state] Executed block                           height=2\n", buf.String())
+}
@@ -0,0 +1,284 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyslogInterpreter parses syslog messages in either of the two standard formats.
+//
+// RFC 3164 (the BSD format), where the priority is optional:
+// <34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8
+//
+// RFC 5424:
+// <165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3"] An application event
+//
+// The priority is split into facility and severity, which are stored by name
+// (like "daemon" and "err"), and the severity is also mapped to a level. The
+// other parts become timestamp (in RFC3339Nano), hostname, app_name, procid,
+// msgid and msg; parts that are missing or given as "-" are left out. RFC 5424
+// structured data is stored in structured_data, as an object with a field for
+// each element's ID, each of which is an object holding that element's parameters.
+//
+// RFC 3164 timestamps have no year or time zone. They are taken to be in Location
+// (or UTC if that is nil), in the year that makes them closest to the current time
+// according to Clock (or the system clock if that is nil), allowing for a little
+// clock skew.
+//
+// If the data is in either format it is consumed; otherwise it is passed on
+// unchanged. Merge controls what happens to fields that are already in the record.
+type SyslogInterpreter struct {
+	Clock    func() time.Time
+	Location *time.Location
+	Merge    Merge
+}
+
+var _ Interpreter = SyslogInterpreter{}
+
+// syslogFacilities are the names of the facilities, in order of their codes
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogSeverities are the names of the severities, in order of their codes
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// syslogLevels maps each severity to our level names
+var syslogLevels = []string{
+	"fatal", "fatal", "fatal", "error", "warn", "info", "info", "debug",
+}
+
+// syslog5424Pat matches the header of an RFC 5424 message, up to the structured data
+var syslog5424Pat = regexp.MustCompile(`^<(\d{1,3})>(\d{1,2}) (\S+) (\S+) (\S+) (\S+) (\S+) ?`)
+
+// syslog3164Pat matches an RFC 3164 message
+var syslog3164Pat = regexp.MustCompile(
+	`^(?:<(\d{1,3})>)?([A-Z][a-z]{2} [ \d]?\d \d\d:\d\d:\d\d) (\S+) (?:([^:\[\s]+)(?:\[([^\]\s]*)\])?: ?)?(.*)$`)
+
+// syslog3164Layout is the layout of RFC 3164 timestamps
+const syslog3164Layout = "Jan _2 15:04:05"
+
+// yearlessSkew is how far in the future a timestamp without a year may be
+// before we decide that it must be from last year
+const yearlessSkew = 7 * 24 * time.Hour
+
+// Interpret implements Interpreter for SyslogInterpreter
+func (i SyslogInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	s := strings.TrimRight(string(data), "\r\n")
+	found, ok := i.parse5424(s)
+	if !ok {
+		found, ok = i.parse3164(s)
+	}
+	if !ok {
+		return data, fields
+	}
+	return nil, i.Merge.Apply(fields, found)
+}
+
+// parse5424 parses an RFC 5424 message.
+func (i SyslogInterpreter) parse5424(s string) (map[string]interface{}, bool) {
+	m := syslog5424Pat.FindStringSubmatch(s)
+	if m == nil {
+		return nil, false
+	}
+	found := map[string]interface{}{}
+	if !setPriority(found, m[1]) {
+		return nil, false
+	}
+	if m[3] != "-" {
+		t, err := time.Parse(time.RFC3339Nano, m[3])
+		if err != nil {
+			return nil, false
+		}
+		found["timestamp"] = t.Format(time.RFC3339Nano)
+	}
+	for n, k := range []string{"hostname", "app_name", "procid", "msgid"} {
+		if v := m[4+n]; v != "-" {
+			found[k] = v
+		}
+	}
+
+	rest := s[len(m[0]):]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		sd, n, ok := parseStructuredData(rest)
+		if !ok {
+			return nil, false
+		}
+		found["structured_data"] = sd
+		rest = rest[n:]
+	}
+	if rest != "" {
+		if rest[0] != ' ' {
+			return nil, false
+		}
+		// the message may start with a byte order mark to say that it's UTF-8
+		if msg := strings.TrimPrefix(rest[1:], "\ufeff"); msg != "" {
+			found["msg"] = msg
+		}
+	}
+	return found, true
+}
+
+// parseStructuredData parses the structured data elements at the start of s,
+// and returns them along with the number of bytes they took up.
+func parseStructuredData(s string) (map[string]interface{}, int, bool) {
+	sd := map[string]interface{}{}
+	pos := 0
+	for pos < len(s) && s[pos] == '[' {
+		pos++
+		end := strings.IndexAny(s[pos:], " ]")
+		if end <= 0 {
+			return nil, 0, false
+		}
+		id := s[pos : pos+end]
+		pos += end
+		params := map[string]interface{}{}
+		for s[pos] == ' ' {
+			pos++
+			eq := strings.IndexByte(s[pos:], '=')
+			if eq <= 0 || pos+eq+1 >= len(s) || s[pos+eq+1] != '"' {
+				return nil, 0, false
+			}
+			name := s[pos : pos+eq]
+			pos += eq + 2
+			var value strings.Builder
+			for {
+				if pos >= len(s) {
+					return nil, 0, false
+				}
+				c := s[pos]
+				pos++
+				if c == '"' {
+					break
+				}
+				// only ", \ and ] are escaped; any other backslash is just a backslash
+				if c == '\\' && pos < len(s) && strings.IndexByte(`"\]`, s[pos]) >= 0 {
+					c = s[pos]
+					pos++
+				}
+				value.WriteByte(c)
+			}
+			params[name] = value.String()
+			if pos >= len(s) {
+				return nil, 0, false
+			}
+		}
+		if s[pos] != ']' {
+			return nil, 0, false
+		}
+		pos++
+		sd[id] = params
+	}
+	if pos == 0 {
+		return nil, 0, false
+	}
+	return sd, pos, true
+}
+
+// parse3164 parses an RFC 3164 message.
+func (i SyslogInterpreter) parse3164(s string) (map[string]interface{}, bool) {
+	m := syslog3164Pat.FindStringSubmatch(s)
+	if m == nil {
+		return nil, false
+	}
+	found := map[string]interface{}{}
+	if m[1] != "" && !setPriority(found, m[1]) {
+		return nil, false
+	}
+	t, err := i.parse3164Time(m[2])
+	if err != nil {
+		return nil, false
+	}
+	found["timestamp"] = t.Format(time.RFC3339Nano)
+	found["hostname"] = m[3]
+	if m[4] != "" {
+		found["app_name"] = m[4]
+	}
+	if m[5] != "" {
+		found["procid"] = m[5]
+	}
+	if m[6] != "" {
+		found["msg"] = m[6]
+	}
+	return found, true
+}
+
+// parse3164Time parses an RFC 3164 timestamp, and works out which year it's in.
+func (i SyslogInterpreter) parse3164Time(s string) (time.Time, error) {
+	loc := i.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(syslog3164Layout, s, loc)
+	if err != nil {
+		return t, err
+	}
+	return inferYear(t, i.Clock), nil
+}
+
+// inferYear puts a time that was parsed without a year into the year that makes
+// it closest to the current time according to clock (or the system clock if that
+// is nil), out of last year, this year and next year. A time up to yearlessSkew
+// in the future is allowed for clock skew, so just after New Year a time from
+// the end of December is put in last year, and just before it a time from the
+// start of January is put in next year. Feb 29 is only put in leap years.
+func inferYear(t time.Time, clock func() time.Time) time.Time {
+	now := time.Now()
+	if clock != nil {
+		now = clock()
+	}
+	now = now.In(t.Location())
+	best := time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	found := false
+	for year := now.Year() - 1; year <= now.Year()+1; year++ {
+		c := time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		if c.Month() != t.Month() || c.Sub(now) > yearlessSkew {
+			continue
+		}
+		if !found || absDuration(c.Sub(now)) < absDuration(best.Sub(now)) {
+			best = c
+			found = true
+		}
+	}
+	return best
+}
+
+// absDuration returns the absolute value of d.
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// setPriority stores the facility, severity and level for a priority value,
+// and reports whether it was valid.
+func setPriority(found map[string]interface{}, pri string) bool {
+	n, err := strconv.Atoi(pri)
+	if err != nil || n >= len(syslogFacilities)*8 || (len(pri) > 1 && pri[0] == '0') {
+		return false
+	}
+	found["facility"] = syslogFacilities[n/8]
+	found["severity"] = syslogSeverities[n%8]
+	found["level"] = syslogLevels[n%8]
+	return true
+}
@@ -0,0 +1,114 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogInterpreter(t *testing.T) {
+	clock := func() time.Time { return time.Date(2020, 1, 3, 12, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name     string
+		input    string
+		wantData string
+		want     map[string]interface{}
+	}{
+		{"not syslog", "hello world", "hello world", map[string]interface{}{}},
+		{"3164", "<34>Jan  2 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8\n", "", map[string]interface{}{
+			"facility": "auth", "severity": "crit", "level": "fatal",
+			"timestamp": "2020-01-02T22:14:15Z", "hostname": "mymachine", "app_name": "su", "procid": "123",
+			"msg": "'su root' failed for lonvick on /dev/pts/8",
+		}},
+		{"3164 last year", "<13>Dec 31 23:59:59 host app: happy new year", "", map[string]interface{}{
+			"facility": "user", "severity": "notice", "level": "info",
+			"timestamp": "2019-12-31T23:59:59Z", "hostname": "host", "app_name": "app", "msg": "happy new year",
+		}},
+		{"3164 slightly in the future", "<14>Jan  4 00:00:00 host app: tomorrow", "", map[string]interface{}{
+			"facility": "user", "severity": "info", "level": "info",
+			"timestamp": "2020-01-04T00:00:00Z", "hostname": "host", "app_name": "app", "msg": "tomorrow",
+		}},
+		{"3164 no priority or tag", "Jan 3 10:00:00 host Something happened: badly", "", map[string]interface{}{
+			"timestamp": "2020-01-03T10:00:00Z", "hostname": "host", "msg": "Something happened: badly",
+		}},
+		{"3164 bad priority", "<192>Jan  3 10:00:00 host app: hi", "<192>Jan  3 10:00:00 host app: hi", map[string]interface{}{}},
+		{"5424", `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] ` + "\ufeff" + `An application event log entry...`, "",
+			map[string]interface{}{
+				"facility": "local4", "severity": "notice", "level": "info",
+				"timestamp": "2003-10-11T22:14:15.003Z", "hostname": "mymachine.example.com", "app_name": "evntslog",
+				"msgid": "ID47",
+				"structured_data": map[string]interface{}{
+					"exampleSDID@32473": map[string]interface{}{"iut": "3", "eventSource": "Application", "eventID": "1011"},
+				},
+				"msg": "An application event log entry...",
+			}},
+		{"5424 several elements and escapes", `<165>1 2003-10-11T22:14:15.003-07:00 host app 42 - [a@1 x="q\"uo\]te\\d" y="\n"][b@2] msg`, "",
+			map[string]interface{}{
+				"facility": "local4", "severity": "notice", "level": "info",
+				"timestamp": "2003-10-11T22:14:15.003-07:00", "hostname": "host", "app_name": "app", "procid": "42",
+				"structured_data": map[string]interface{}{
+					"a@1": map[string]interface{}{"x": `q"uo]te\d`, "y": `\n`},
+					"b@2": map[string]interface{}{},
+				},
+				"msg": "msg",
+			}},
+		{"5424 nil values", "<7>1 - - - - - -", "", map[string]interface{}{
+			"facility": "kern", "severity": "debug", "level": "debug",
+		}},
+		{"5424 bad structured data", `<7>1 - - - - - [a x="1"`, `<7>1 - - - - - [a x="1"`, map[string]interface{}{}},
+		{"5424 bad timestamp", `<7>1 yesterday - - - - -`, `<7>1 yesterday - - - - -`, map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := SyslogInterpreter{Clock: clock}
+			data, fields := i.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Equal(t, tt.wantData, string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestSyslogInterpreterLocation(t *testing.T) {
+	loc := time.FixedZone("EST", -5*60*60)
+	i := SyslogInterpreter{
+		Clock:    func() time.Time { return time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC) },
+		Location: loc,
+	}
+	_, fields := i.Interpret([]byte("Jun  1 10:00:00 host app: hi"), map[string]interface{}{})
+	assert.Equal(t, "2020-06-01T10:00:00-05:00", fields["timestamp"])
+}
+
+func TestInferYear(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		in   string
+		want string
+	}{
+		{"same year", time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), "Jun  1 10:00:00", "2020-06-01T10:00:00Z"},
+		{"a little ahead", time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), "Jun  3 10:00:00", "2020-06-03T10:00:00Z"},
+		{"too far ahead", time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), "Jul  1 10:00:00", "2019-07-01T10:00:00Z"},
+		{"just before new year", time.Date(2020, 12, 31, 23, 59, 0, 0, time.UTC), "Jan  1 00:01:00", "2021-01-01T00:01:00Z"},
+		{"just after new year", time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC), "Dec 31 23:59:00", "2020-12-31T23:59:00Z"},
+		{"leap day", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), "Feb 29 12:00:00", "2020-02-29T12:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := time.Parse(syslog3164Layout, tt.in)
+			assert.NoError(t, err)
+			got := inferYear(parsed, func() time.Time { return tt.now })
+			assert.Equal(t, tt.want, got.Format(time.RFC3339Nano))
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hash is a hash from a Tendermint block dump. It is written out the way
+// Tendermint writes it, as upper-case hex.
+type Hash []byte
+
+// String implements fmt.Stringer for Hash
+func (h Hash) String() string {
+	return strings.ToUpper(hex.EncodeToString(h))
+}
+
+// MarshalText implements encoding.TextMarshaler for Hash
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for Hash
+func (h *Hash) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*h = b
+	return nil
+}
+
+// Tendermint abbreviates some hashes to 12 hex digits; anything shorter is
+// more likely to be something else.
+var tmHashPat = regexp.MustCompile(`^(?:[0-9A-F]{2}){6,}$`)
+
+// pattern for the line that opens a block, like "Header{"
+var tmOpenPat = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9]*)\{$`)
+
+// pattern for a Key: value line within a block; the value may be empty
+var tmBlockFieldPat = regexp.MustCompile(`^([A-Z][A-Za-z0-9]+):[ \t]*(.*)$`)
+
+// the layouts Tendermint uses for times in block dumps
+var tmTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339Nano,
+}
+
+// tmBlock is a block that is still being parsed
+type tmBlock struct {
+	obj map[string]interface{}
+	// list is the key of a field with no value of its own, which collects the
+	// unlabelled lines after it (like the votes under Precommits).
+	list string
+}
+
+// parseBlocks rebuilds the brace-delimited blocks in a Tendermint message as
+// nested objects, and returns the outermost ones by name. A block that closes
+// with }#hash gets that hash as its Hash field. Text outside any block is ignored.
+func parseBlocks(s string) map[string]interface{} {
+	top := map[string]interface{}{}
+	stack := []*tmBlock{}
+	for _, line := range tmLinePat.Split(s, -1) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if r := tmOpenPat.FindStringSubmatch(line); r != nil {
+			obj := map[string]interface{}{}
+			if len(stack) == 0 {
+				top[r[1]] = obj
+			} else {
+				parent := stack[len(stack)-1]
+				parent.obj[r[1]] = obj
+				parent.list = ""
+			}
+			stack = append(stack, &tmBlock{obj: obj})
+			continue
+		}
+		if len(stack) == 0 {
+			continue
+		}
+		current := stack[len(stack)-1]
+		if strings.HasPrefix(line, "}") {
+			if rest := line[1:]; strings.HasPrefix(rest, "#") && len(rest) > 1 {
+				current.obj["Hash"] = blockValue(rest[1:])
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if r := tmBlockFieldPat.FindStringSubmatch(line); r != nil {
+			if r[2] == "" {
+				current.obj[r[1]] = ""
+				current.list = r[1]
+			} else {
+				current.obj[r[1]] = blockValue(r[2])
+				current.list = ""
+			}
+			continue
+		}
+		if current.list != "" {
+			items, _ := current.obj[current.list].([]interface{})
+			current.obj[current.list] = append(items, line)
+		}
+	}
+	return top
+}
+
+// blockValue converts a value from a block dump to an int, a Hash or a
+// time.Time if it looks like one, and otherwise returns it as a string.
+func blockValue(s string) interface{} {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	if tmHashPat.MatchString(s) {
+		if h, err := hex.DecodeString(s); err == nil {
+			return Hash(h)
+		}
+	}
+	for _, layout := range tmTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return s
+}
+
+// lookupPath finds the value at a dotted path like Block.Header.Height.
+func lookupPath(obj map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := obj[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		obj = next
+	}
+	v, ok := obj[parts[len(parts)-1]]
+	return v, ok
+}
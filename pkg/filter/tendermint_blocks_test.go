@@ -0,0 +1,144 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustHash(t *testing.T, s string) Hash {
+	var h Hash
+	require.NoError(t, h.UnmarshalText([]byte(s)))
+	return h
+}
+
+func interpretTmBlock(t *testing.T, r Interpreter) map[string]interface{} {
+	line := strings.TrimSpace(sampleTmLogsExtraFields)
+	data, fields := JSONInterpreter{}.Interpret([]byte(line), map[string]interface{}{})
+	data, fields = r.Interpret(data, fields)
+	assert.Empty(t, data)
+	return fields
+}
+
+func TestTendermintInterpreterNested(t *testing.T) {
+	// the default is still just the flat fields
+	fields := interpretTmBlock(t, NewTendermintInterpreter())
+	assert.Equal(t, 2, fields["Height"])
+	assert.NotContains(t, fields, "Block")
+
+	fields = interpretTmBlock(t, TendermintInterpreter{Keys: []string{"_msg"}, Nested: true})
+
+	// the flat fields are still there, as they always were
+	assert.Equal(t, 2, fields["Height"])
+	assert.Equal(t, "2019-04-27 01:13:43.232704 +0000 UTC", fields["Time"])
+
+	block, ok := fields["Block"].(map[string]interface{})
+	require.True(t, ok, "Block should be an object: %#v", fields["Block"])
+	assert.Equal(t, mustHash(t, "F4006F1F2544906BC057B8AEFB1B5305264605F1456D78B5DC48C66D84823BBD"), block["Hash"])
+
+	header, ok := block["Header"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, 2, header["Height"])
+	assert.Equal(t, "localnet", header["ChainID"])
+	assert.Equal(t, "{10 0}", header["Version"])
+	assert.Equal(t, time.Date(2019, 4, 27, 1, 13, 43, 232704000, time.UTC), header["Time"].(time.Time).UTC())
+	assert.Equal(t, mustHash(t, "497B1D7E8CD2C6D43C9326145E6C3819179EFE9E"), header["Proposer"])
+	assert.Equal(t, "", header["Data"])
+	assert.Equal(t, mustHash(t, "F4006F1F2544906BC057B8AEFB1B5305264605F1456D78B5DC48C66D84823BBD"), header["Hash"])
+
+	assert.Equal(t, map[string]interface{}{}, block["Data"])
+	assert.Equal(t, map[string]interface{}{}, block["EvidenceData"])
+
+	commit, ok := block["Commit"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "528F0CCA2BC8CE9FDAD1394BDCBCF544B69961845DF80847B8DFED5E3EA3C59A:1:3BD8D1307A95", commit["BlockID"])
+	assert.Equal(t, []interface{}{
+		"Vote{0:2D0AA78150B6 1/00/2(Precommit) 528F0CCA2BC8 9B76B58D8E6E @ 2019-04-27T01:13:43.336014Z}",
+		"Vote{1:497B1D7E8CD2 1/00/2(Precommit) 528F0CCA2BC8 D932148F1631 @ 2019-04-27T01:13:43.232704Z}",
+	}, commit["Precommits"])
+}
+
+func TestTendermintInterpreterPaths(t *testing.T) {
+	r := TendermintInterpreter{
+		Keys: []string{"_msg"},
+		Paths: map[string]string{
+			"Block.Header.Height":   "height",
+			"Block.Header.Proposer": "proposer",
+			"Block.Hash":            "block_hash",
+			"Block.Nothing.Here":    "missing",
+		},
+	}
+	fields := interpretTmBlock(t, r)
+	assert.NotContains(t, fields, "Block")
+	assert.NotContains(t, fields, "missing")
+	assert.Equal(t, 2, fields["height"])
+
+	out, err := json.Marshal(map[string]interface{}{
+		"proposer":   fields["proposer"],
+		"block_hash": fields["block_hash"],
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"proposer": "497B1D7E8CD2C6D43C9326145E6C3819179EFE9E",
+		"block_hash": "F4006F1F2544906BC057B8AEFB1B5305264605F1456D78B5DC48C66D84823BBD"
+	}`, string(out))
+}
+
+func TestTendermintInterpreterFlatOnly(t *testing.T) {
+	r := TendermintInterpreter{Keys: []string{"_msg"}}
+	fields := interpretTmBlock(t, r)
+	assert.NotContains(t, fields, "Block")
+	assert.Equal(t, 2, fields["Height"])
+}
+
+func TestBlockValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+	}{
+		{"int", "42", 42},
+		{"string", "localnet", "localnet"},
+		{"short hash", "3BD8D1307A95", Hash{0x3b, 0xd8, 0xd1, 0x30, 0x7a, 0x95}},
+		{"too short for a hash", "3BD8D1", "3BD8D1"},
+		{"odd length", "3BD8D1307A951", "3BD8D1307A951"},
+		{"lower case", "3bd8d1307a95", "3bd8d1307a95"},
+		{"go time", "2019-04-27 01:13:43.232704 +0000 UTC", time.Date(2019, 4, 27, 1, 13, 43, 232704000, time.UTC)},
+		{"rfc3339", "2019-04-27T01:13:43.336014Z", time.Date(2019, 4, 27, 1, 13, 43, 336014000, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := blockValue(tt.input)
+			if want, ok := tt.want.(time.Time); ok {
+				assert.True(t, want.Equal(got.(time.Time)), "got %v", got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseBlocksUnbalanced(t *testing.T) {
+	got := parseBlocks("Executed\nOuter{\n  Height: 1\n  Inner{\n    Name: x\n")
+	assert.Equal(t, map[string]interface{}{
+		"Outer": map[string]interface{}{
+			"Height": 1,
+			"Inner":  map[string]interface{}{"Name": "x"},
+		},
+	}, got)
+	assert.Equal(t, map[string]interface{}{}, parseBlocks("}\n}#ABCD\nHeight: 1"))
+}
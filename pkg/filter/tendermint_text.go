@@ -0,0 +1,98 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TendermintTextInterpreter parses the plain-text log format that Tendermint
+// writes when it isn't configured for JSON logging.
+// Example:
+// I[2019-04-18|15:18:28.565] Executed block                               module=state height=5 validTxs=1
+// level[date|time] message key=value key="quoted value" ...
+//
+// The level letter becomes level, the time becomes timestamp (in RFC3339Nano),
+// the message becomes msg, and each key=value pair becomes a field. Unquoted
+// values that look like integers, floats or booleans are stored as those types;
+// quoted values are always strings.
+//
+// If the data is in this format it is consumed; otherwise it is passed on
+// unchanged. This is meant to be used with a line splitter.
+// Merge controls what happens to fields that are already in the record.
+type TendermintTextInterpreter struct {
+	Merge Merge
+}
+
+var _ Interpreter = TendermintTextInterpreter{}
+
+// TendermintTimeFormat is the layout of the timestamps in Tendermint's plain-text logs.
+const TendermintTimeFormat = "2006-01-02|15:04:05.000"
+
+// tendermintTextPat matches the level and timestamp that start every line
+var tendermintTextPat = regexp.MustCompile(`^([DIWE])\[(\d{4}-\d\d-\d\d\|\d\d:\d\d:\d\d\.\d{3})\] ?`)
+
+// tendermintLevels maps the level letters to our level names
+var tendermintLevels = map[string]string{
+	"D": "debug",
+	"I": "info",
+	"W": "warn",
+	"E": "error",
+}
+
+// Interpret implements Interpreter for TendermintTextInterpreter
+func (i TendermintTextInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	s := strings.TrimRight(string(data), "\r\n")
+	matches := tendermintTextPat.FindStringSubmatch(s)
+	if matches == nil {
+		return data, fields
+	}
+
+	found := map[string]interface{}{}
+	found["level"] = tendermintLevels[matches[1]]
+	t, err := time.Parse(TendermintTimeFormat, matches[2])
+	if err != nil {
+		found["timestamp"] = matches[2]
+	} else {
+		found["timestamp"] = t.Format(time.RFC3339Nano)
+	}
+
+	msg, pairs := splitMessage(s[len(matches[0]):])
+	found["msg"] = msg
+	fields = i.Merge.Apply(fields, found)
+	// the pairs are applied in order so that Rename sees duplicates the same way every time
+	for _, p := range pairs {
+		fields = i.Merge.Set(fields, p.key, p.typed())
+	}
+	return nil, fields
+}
+
+// kvStartPat matches the beginning of something that might be a key=value pair
+var kvStartPat = regexp.MustCompile(`(^|[ \t])[A-Za-z_][A-Za-z0-9_.\-]*=`)
+
+// splitMessage divides the text after the timestamp into the message and the
+// key=value pairs after it. The message ends at the first place from which the
+// whole rest of the line is made of pairs.
+func splitMessage(s string) (string, []keyValue) {
+	for _, loc := range kvStartPat.FindAllStringIndex(s, -1) {
+		start := loc[0]
+		if start < len(s) && (s[start] == ' ' || s[start] == '\t') {
+			start++
+		}
+		if pairs, ok := parseKeyValues(s[start:], false); ok {
+			return strings.TrimSpace(s[:start]), pairs
+		}
+	}
+	return strings.TrimSpace(s), nil
+}
@@ -0,0 +1,77 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTendermintTextInterpreter(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantData string
+		want     map[string]interface{}
+	}{
+		{"not tendermint", "hello world", "hello world", map[string]interface{}{}},
+		{"bad level", "X[2019-04-18|15:18:28.565] hello", "X[2019-04-18|15:18:28.565] hello", map[string]interface{}{}},
+		{"message only", "I[2019-04-18|15:18:28.565] Starting node", "", map[string]interface{}{
+			"level": "info", "timestamp": "2019-04-18T15:18:28.565Z", "msg": "Starting node",
+		}},
+		{"executed block", "I[2019-04-18|15:18:28.565] Executed block                               module=state height=5 validTxs=1 invalidTxs=0\n", "",
+			map[string]interface{}{
+				"level": "info", "timestamp": "2019-04-18T15:18:28.565Z", "msg": "Executed block",
+				"module": "state", "height": 5, "validTxs": 1, "invalidTxs": 0,
+			}},
+		{"quoted values", `E[2019-04-18|15:18:28.000] Stopping peer for error                      module=p2p peer="Peer{MConn{1.2.3.4:26656} abc out}" err=EOF`, "",
+			map[string]interface{}{
+				"level": "error", "timestamp": "2019-04-18T15:18:28Z", "msg": "Stopping peer for error",
+				"module": "p2p", "peer": "Peer{MConn{1.2.3.4:26656} abc out}", "err": "EOF",
+			}},
+		{"escapes", `D[2019-04-18|15:18:28.565] Said something                                 module=x what="a \"b\"\tc"`, "",
+			map[string]interface{}{
+				"level": "debug", "timestamp": "2019-04-18T15:18:28.565Z", "msg": "Said something",
+				"module": "x", "what": "a \"b\"\tc",
+			}},
+		{"types", "I[2019-04-18|15:18:28.565] Types ok=true no=false f=1.5 neg=-3 hash=3D4F inf=+Inf", "",
+			map[string]interface{}{
+				"level": "info", "timestamp": "2019-04-18T15:18:28.565Z", "msg": "Types",
+				"ok": true, "no": false, "f": 1.5, "neg": -3, "hash": "3D4F", "inf": "+Inf",
+			}},
+		{"equals in message", "I[2019-04-18|15:18:28.565] set a=b then stopped      module=x", "",
+			map[string]interface{}{
+				"level": "info", "timestamp": "2019-04-18T15:18:28.565Z", "msg": "set a=b then stopped",
+				"module": "x",
+			}},
+		{"unterminated quote", `I[2019-04-18|15:18:28.565] Oops k="abc`, "",
+			map[string]interface{}{
+				"level": "info", "timestamp": "2019-04-18T15:18:28.565Z", "msg": `Oops k="abc`,
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := TendermintTextInterpreter{}
+			data, fields := i.Interpret([]byte(tt.input), map[string]interface{}{})
+			assert.Equal(t, tt.wantData, string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestTendermintTextInterpreterMerge(t *testing.T) {
+	i := TendermintTextInterpreter{Merge: Merge{Policy: KeepFirst}}
+	fields := map[string]interface{}{"module": "node"}
+	_, fields = i.Interpret([]byte("I[2019-04-18|15:18:28.565] Executed block module=state height=5"), fields)
+	assert.Equal(t, "node", fields["module"])
+	assert.Equal(t, 5, fields["height"])
+}
@@ -0,0 +1,203 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimestampKeys are the fields TimestampInterpreter looks in if it isn't given any
+var DefaultTimestampKeys = []string{"ts", "time", "timestamp", "@timestamp", "_t"}
+
+// timestampLayouts are the layouts TimestampInterpreter tries after its own
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	TendermintTimeFormat,
+}
+
+// TimestampInterpreter normalizes the timestamp of a record. It looks for the
+// time in each of Keys in turn (or DefaultTimestampKeys, if Keys is empty), and
+// stores the first one it finds in Target (or "timestamp", if Target is empty)
+// as an RFC3339Nano string in UTC.
+//
+// Strings are parsed with each of Layouts, then as numbers, then as RFC3339 or
+// with a few similar layouts, and then with TendermintTimeFormat. Times without
+// a zone are taken to be in Location, or UTC if that is nil. Numbers, and strings
+// that are numbers, are Unix times in seconds, milliseconds, microseconds or
+// nanoseconds, depending on their size; seconds may have a fraction. Nanoseconds
+// can't be represented exactly by float64, so use JSONInterpreter's UseNumber to
+// keep them exact. time.Time values are accepted as they are.
+//
+// A value that can't be parsed is moved to UnparsedKey (or "timestamp_unparsed",
+// if that is empty), so that Target never holds anything but a valid timestamp.
+// That includes a value already in Target that is replaced by the time from an
+// earlier key.
+// Records that have none of the keys are left alone. The data is always passed
+// on unchanged.
+//
+// Target is always replaced, since normalizing it is the point; Merge controls
+// what happens if UnparsedKey is already in the record.
+type TimestampInterpreter struct {
+	Keys        []string
+	Target      string
+	Layouts     []string
+	Location    *time.Location
+	UnparsedKey string
+	Merge       Merge
+}
+
+var _ Interpreter = TimestampInterpreter{}
+
+// Interpret implements Interpreter for TimestampInterpreter
+func (i TimestampInterpreter) Interpret(data []byte,
+	fields map[string]interface{}) ([]byte, map[string]interface{}) {
+	keys := i.Keys
+	if len(keys) == 0 {
+		keys = DefaultTimestampKeys
+	}
+	target := i.Target
+	if target == "" {
+		target = "timestamp"
+	}
+	for _, k := range keys {
+		v, ok := fields[k]
+		if !ok || v == nil {
+			continue
+		}
+		t, err := i.parse(v)
+		if err != nil {
+			if k == target {
+				delete(fields, target)
+			}
+			return data, i.unparsed(fields, v)
+		}
+		if old, ok := fields[target]; ok && k != target {
+			// don't lose something in the target that isn't a time
+			if _, err := i.parse(old); err != nil {
+				fields = i.unparsed(fields, old)
+			}
+		}
+		fields[target] = t.UTC().Format(time.RFC3339Nano)
+		return data, fields
+	}
+	return data, fields
+}
+
+// unparsed stores a value that couldn't be parsed in UnparsedKey.
+func (i TimestampInterpreter) unparsed(fields map[string]interface{}, v interface{}) map[string]interface{} {
+	key := i.UnparsedKey
+	if key == "" {
+		key = "timestamp_unparsed"
+	}
+	return i.Merge.Set(fields, key, v)
+}
+
+// errNotTime is returned by parse for values that aren't times
+var errNotTime = errors.New("not a recognized time")
+
+// parse works out the time a value represents.
+func (i TimestampInterpreter) parse(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		return i.parseString(t)
+	case []byte:
+		return i.parseString(string(t))
+	case json.Number:
+		return i.parseString(t.String())
+	case int:
+		return unixTime(int64(t)), nil
+	case int64:
+		return unixTime(t), nil
+	case float64:
+		return unixFloat(t)
+	}
+	return time.Time{}, errNotTime
+}
+
+// parseString parses a time from a string, which may be a number.
+func (i TimestampInterpreter) parseString(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	loc := i.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	// custom layouts go first, in case they look like numbers
+	if t, ok := parseLayouts(i.Layouts, s, loc); ok {
+		return t, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return unixTime(n), nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return unixFloat(f)
+	}
+	if t, ok := parseLayouts(timestampLayouts, s, loc); ok {
+		return t, nil
+	}
+	return time.Time{}, errNotTime
+}
+
+// parseLayouts returns the time given by the first layout that parses s.
+func parseLayouts(layouts []string, s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// unixTime converts a Unix time to a time.Time. Its unit is worked out from its
+// size: anything that would be after the year 5000 in seconds is taken to be in
+// milliseconds, and so on.
+func unixTime(n int64) time.Time {
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs < 1e11:
+		return time.Unix(n, 0)
+	case abs < 1e14:
+		return time.Unix(n/1e3, n%1e3*1e6)
+	case abs < 1e17:
+		return time.Unix(n/1e6, n%1e6*1e3)
+	}
+	return time.Unix(0, n)
+}
+
+// unixFloat is unixTime for a number that may have a fraction, which is only
+// allowed in seconds.
+func unixFloat(f float64) (time.Time, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) >= math.MaxInt64 {
+		return time.Time{}, errNotTime
+	}
+	if f == math.Trunc(f) {
+		return unixTime(int64(f)), nil
+	}
+	if math.Abs(f) >= 1e11 {
+		return time.Time{}, errNotTime
+	}
+	sec, frac := math.Modf(f)
+	// round to microseconds, which is all the precision a float64 has left
+	nsec := int64(math.Round(frac*1e6)) * 1e3
+	return time.Unix(int64(sec), nsec), nil
+}
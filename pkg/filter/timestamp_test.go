@@ -0,0 +1,109 @@
+package filter
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampInterpreter(t *testing.T) {
+	const want = "2019-04-18T15:18:28.565Z"
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{"no timestamp", map[string]interface{}{"msg": "hi"}, map[string]interface{}{"msg": "hi"}},
+		{"rfc3339", map[string]interface{}{"ts": "2019-04-18T17:18:28.565+02:00"}, map[string]interface{}{
+			"ts": "2019-04-18T17:18:28.565+02:00", "timestamp": want,
+		}},
+		{"rfc3339 in target", map[string]interface{}{"timestamp": "2019-04-18T15:18:28.565000Z"}, map[string]interface{}{
+			"timestamp": want,
+		}},
+		{"space separated", map[string]interface{}{"time": "2019-04-18 15:18:28.565"}, map[string]interface{}{
+			"time": "2019-04-18 15:18:28.565", "timestamp": want,
+		}},
+		{"tendermint", map[string]interface{}{"_t": "2019-04-18|15:18:28.565"}, map[string]interface{}{
+			"_t": "2019-04-18|15:18:28.565", "timestamp": want,
+		}},
+		{"seconds", map[string]interface{}{"ts": 1555600708}, map[string]interface{}{
+			"ts": 1555600708, "timestamp": "2019-04-18T15:18:28Z",
+		}},
+		{"fractional seconds", map[string]interface{}{"ts": 1555600708.565}, map[string]interface{}{
+			"ts": 1555600708.565, "timestamp": want,
+		}},
+		{"milliseconds", map[string]interface{}{"ts": 1555600708565.0}, map[string]interface{}{
+			"ts": 1555600708565.0, "timestamp": want,
+		}},
+		{"millisecond string", map[string]interface{}{"ts": "1555600708565"}, map[string]interface{}{
+			"ts": "1555600708565", "timestamp": want,
+		}},
+		{"microseconds", map[string]interface{}{"ts": int64(1555600708565000)}, map[string]interface{}{
+			"ts": int64(1555600708565000), "timestamp": want,
+		}},
+		{"nanoseconds", map[string]interface{}{"ts": json.Number("1555600708565000001")}, map[string]interface{}{
+			"ts": json.Number("1555600708565000001"), "timestamp": "2019-04-18T15:18:28.565000001Z",
+		}},
+		{"time value", map[string]interface{}{"@timestamp": time.Date(2019, 4, 18, 15, 18, 28, 565e6, time.UTC)}, map[string]interface{}{
+			"@timestamp": time.Date(2019, 4, 18, 15, 18, 28, 565e6, time.UTC), "timestamp": want,
+		}},
+		{"unparseable", map[string]interface{}{"ts": "yesterday"}, map[string]interface{}{
+			"ts": "yesterday", "timestamp_unparsed": "yesterday",
+		}},
+		{"unparseable in target", map[string]interface{}{"timestamp": "soon"}, map[string]interface{}{
+			"timestamp_unparsed": "soon",
+		}},
+		{"not a number", map[string]interface{}{"ts": true}, map[string]interface{}{
+			"ts": true, "timestamp_unparsed": true,
+		}},
+		{"unparseable target replaced", map[string]interface{}{"ts": 1555600708, "timestamp": "garbage"}, map[string]interface{}{
+			"ts": 1555600708, "timestamp": "2019-04-18T15:18:28Z", "timestamp_unparsed": "garbage",
+		}},
+		{"valid target replaced", map[string]interface{}{"ts": 1555600708, "timestamp": "2019-04-18T15:18:29Z"}, map[string]interface{}{
+			"ts": 1555600708, "timestamp": "2019-04-18T15:18:28Z",
+		}},
+		{"first key wins", map[string]interface{}{"ts": "1555600708565", "time": "bogus"}, map[string]interface{}{
+			"ts": "1555600708565", "time": "bogus", "timestamp": want,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, fields := TimestampInterpreter{}.Interpret([]byte("rest"), tt.fields)
+			assert.Equal(t, "rest", string(data))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestTimestampInterpreterOptions(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	i := TimestampInterpreter{
+		Keys:        []string{"date"},
+		Target:      "at",
+		Layouts:     []string{"20060102150405"},
+		Location:    est,
+		UnparsedKey: "bad_date",
+	}
+	_, fields := i.Interpret(nil, map[string]interface{}{"date": "20190418101828"})
+	assert.Equal(t, map[string]interface{}{"date": "20190418101828", "at": "2019-04-18T15:18:28Z"}, fields)
+	_, fields = i.Interpret(nil, map[string]interface{}{"date": "2019-04-18 10:18:28"})
+	assert.Equal(t, "2019-04-18T15:18:28Z", fields["at"])
+	_, fields = i.Interpret(nil, map[string]interface{}{"date": "never"})
+	assert.Equal(t, map[string]interface{}{"date": "never", "bad_date": "never"}, fields)
+
+	i = TimestampInterpreter{Merge: Merge{Policy: Rename}}
+	_, fields = i.Interpret(nil, map[string]interface{}{"ts": "x", "timestamp_unparsed": "y"})
+	assert.Equal(t, map[string]interface{}{"ts": "x", "timestamp_unparsed": "y", "dup_timestamp_unparsed": "x"}, fields)
+}
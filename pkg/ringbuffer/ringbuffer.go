@@ -11,6 +11,7 @@ package ringbuffer
 
 
 import (
+	"errors"
 	"io"
 	"sync"
 
@@ -39,16 +40,46 @@ import (
 //
 // Calling Close() prevents further writes, and after the entire input has been
 // consumed, returns EOF for further read operations.
+//
+// By default the buffer grows without limit. SetLimit caps its length, and chooses
+// what Write does when the reader falls behind; see OverflowPolicy.
 type RingBuffer struct {
 	C chan struct{}
 
-	mutex  sync.Mutex
-	buf    []byte
-	len    int
-	index  int
-	closed bool
+	mutex   sync.Mutex
+	space   *sync.Cond
+	buf     []byte
+	len     int
+	index   int
+	closed  bool
+	limit   int
+	policy  OverflowPolicy
+	dropped int
+	drops   int
+	notify  func(written, dropped int)
 }
 
+// OverflowPolicy determines what Write does when a RingBuffer with a limit
+// doesn't have room for the data being written.
+type OverflowPolicy int
+
+const (
+	// Block makes Write wait until the reader has consumed enough to make room.
+	// Writes larger than the limit are written in pieces as space becomes available.
+	Block OverflowPolicy = iota
+	// DropNewest throws away the data being written, but reports it as written.
+	DropNewest
+	// DropOldest throws away as much unread data from the front of the buffer
+	// as is needed to make room for the new data.
+	DropOldest
+	// Fail makes Write return ErrFull without writing anything.
+	Fail
+)
+
+// ErrFull is returned by Write when the buffer is at its limit and the
+// policy is Fail.
+var ErrFull = errors.New("ringbuffer: buffer is full")
+
 var _ io.ReadWriteCloser = (*RingBuffer)(nil)
 var _ bufio.ScannerReader = (*RingBuffer)(nil)
 
@@ -56,43 +87,108 @@ var _ bufio.ScannerReader = (*RingBuffer)(nil)
 // The buffer will grow if necessary to accommodate Write() calls. It never
 // shrinks.
 func New(capacity int) *RingBuffer {
-	return &RingBuffer{
+	c := &RingBuffer{
 		C:     make(chan struct{}, 1),
 		buf:   make([]byte, capacity),
 		len:   0,
 		index: 0,
 	}
+	c.space = sync.NewCond(&c.mutex)
+	return c
+}
+
+// SetLimit caps the length of the buffer at limit bytes (a limit of 0 or less means
+// no limit), and sets the policy that Write follows when there isn't room. It
+// should be called before the buffer is in use.
+func (c *RingBuffer) SetLimit(limit int, policy OverflowPolicy) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.limit = limit
+	c.policy = policy
+}
+
+// SetNotify arranges for notify to be called every time data is added to the
+// buffer, including each piece of a Write that blocks, with the number of bytes
+// written, and every time a Write throws data away, with the number of bytes
+// dropped. It is called with the buffer locked, so the calls are in the order
+// the writes happened, but notify mustn't use the buffer itself. It should be
+// called before the buffer is in use.
+func (c *RingBuffer) SetNotify(notify func(written, dropped int)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.notify = notify
 }
 
 // Write implements io.Writer for RingBuffer. Note that if all of p cannot be written to the
-// buffer as it stands, the buffer's capacity is grown. This call will return io.EOF if
-// Close() has been called; otherwise it will only error if the buffer cannot be expanded.
+// buffer as it stands, the buffer's capacity is grown, up to the limit if one was set.
+// Past the limit, what happens depends on the OverflowPolicy. This call will return
+// io.EOF if Close() has been called (including while it is blocked waiting for space),
+// and ErrFull if p doesn't fit and the policy is Fail; otherwise it will only error if
+// the buffer cannot be expanded.
 func (c *RingBuffer) Write(p []byte) (int, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	if c.closed {
 		return 0, io.EOF
 	}
-	if len(p) > len(c.buf)-c.len {
-		_, err := c.resize(len(p) + c.len)
-		if err != nil {
+	if c.limit <= 0 || c.len+len(p) <= c.limit {
+		return c.write(p)
+	}
+
+	switch c.policy {
+	case Fail:
+		return 0, ErrFull
+	case DropNewest:
+		c.drop(len(p))
+		return len(p), nil
+	case DropOldest:
+		n := len(p)
+		lost := 0
+		if n > c.limit {
+			// the front of p would be thrown away immediately anyway
+			lost += n - c.limit
+			p = p[n-c.limit:]
+		}
+		if excess := c.len + len(p) - c.limit; excess > 0 {
+			lost += c.consume(excess)
+		}
+		c.drop(lost)
+		if _, err := c.write(p); err != nil {
 			return 0, err
 		}
+		return n, nil
+	default:
+		written := 0
+		for written < len(p) {
+			for c.len >= c.limit && !c.closed {
+				c.space.Wait()
+			}
+			if c.closed {
+				return written, io.EOF
+			}
+			chunk := len(p) - written
+			if room := c.limit - c.len; chunk > room {
+				chunk = room
+			}
+			n, err := c.write(p[written : written+chunk])
+			written += n
+			if err != nil {
+				return written, err
+			}
+		}
+		return written, nil
 	}
+}
 
-	startWritingAt := (c.index + c.len) % len(c.buf)
-	leftBeforeEnd := len(c.buf) - startWritingAt
-	n := 0
-	if len(p) <= leftBeforeEnd {
-		// it all fits in before it's time to wrap
-		n = copy(c.buf[startWritingAt:], p)
-	} else {
-		// it didn't all fit in before we have to wrap
-		n = copy(c.buf[startWritingAt:], p[:leftBeforeEnd])
-		n += copy(c.buf[:startWritingAt], p[leftBeforeEnd:])
-	}
-	c.addLen(len(p))
-	return n, nil
+// Dropped returns the number of bytes that have been thrown away by the DropNewest or
+// DropOldest policies, and the number of Write calls that threw data away, since the
+// last call to Dropped.
+func (c *RingBuffer) Dropped() (bytes int, writes int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	bytes, writes = c.dropped, c.drops
+	c.dropped, c.drops = 0, 0
+	return bytes, writes
 }
 
 // Read implements io.Reader for RingBuffer. It is the equivalent of calling
@@ -154,6 +250,8 @@ func (c *RingBuffer) Close() error {
 	defer c.mutex.Unlock()
 	c.closed = true
 	close(c.C)
+	// wake up any writers waiting for space so that they see we're closed
+	c.space.Broadcast()
 	return nil
 }
 
@@ -161,6 +259,44 @@ func (c *RingBuffer) Close() error {
 // Note to maintainers:
 // all public methods must use a mutex, and no private ones should.
 
+// write copies p into the buffer, growing it if necessary.
+// It does not lock or look at the limit.
+func (c *RingBuffer) write(p []byte) (int, error) {
+	if len(p) > len(c.buf)-c.len {
+		_, err := c.resize(len(p) + c.len)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	startWritingAt := (c.index + c.len) % len(c.buf)
+	leftBeforeEnd := len(c.buf) - startWritingAt
+	n := 0
+	if len(p) <= leftBeforeEnd {
+		// it all fits in before it's time to wrap
+		n = copy(c.buf[startWritingAt:], p)
+	} else {
+		// it didn't all fit in before we have to wrap
+		n = copy(c.buf[startWritingAt:], p[:leftBeforeEnd])
+		n += copy(c.buf[:startWritingAt], p[leftBeforeEnd:])
+	}
+	c.addLen(len(p))
+	if c.notify != nil && len(p) > 0 {
+		c.notify(len(p), 0)
+	}
+	return n, nil
+}
+
+// drop records that a Write threw away n bytes.
+// It does not lock.
+func (c *RingBuffer) drop(n int) {
+	c.dropped += n
+	c.drops++
+	if c.notify != nil {
+		c.notify(0, n)
+	}
+}
+
 func (c *RingBuffer) addLen(n int) {
 	c.len += n
 	// when we set the length, if it's nonzero, send the value on
@@ -182,6 +318,9 @@ func (c *RingBuffer) consume(n int) int {
 	}
 	c.index = (c.index + n) % len(c.buf)
 	c.addLen(-n)
+	if n > 0 {
+		c.space.Broadcast()
+	}
 	return n
 }
 
@@ -210,6 +349,7 @@ func (c *RingBuffer) peek(p []byte) (int, error) {
 // In general, we double the buffer size each time unless it's already bigger
 // than 8K, in which case we only increase it by 25%.
 // But if minSize is bigger than that number, we'll use minSize instead.
+// If there's a limit, the buffer doesn't grow past it unless minSize requires it.
 func (c *RingBuffer) resize(minSize int) (int, error) {
 	// first figure out how big it should be
 	quarters := 8
@@ -217,6 +357,9 @@ func (c *RingBuffer) resize(minSize int) (int, error) {
 		quarters = 5
 	}
 	newSize := len(c.buf) * quarters / 4
+	if c.limit > 0 && newSize > c.limit {
+		newSize = c.limit
+	}
 	if minSize > newSize {
 		newSize = minSize
 	}
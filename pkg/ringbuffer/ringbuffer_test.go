@@ -467,3 +467,126 @@ func TestRingBufferLongRun(t *testing.T) {
 		t.Errorf("sent %d not equal to received %d\n", sent, received)
 	}
 }
+
+func TestRingBufferLimitFail(t *testing.T) {
+	c := New(4)
+	c.SetLimit(10, Fail)
+	n, err := c.Write([]byte("abcdefgh"))
+	assert.Nil(t, err)
+	assert.Equal(t, 8, n)
+	n, err = c.Write([]byte("ijk"))
+	assert.Equal(t, ErrFull, err)
+	assert.Zero(t, n)
+	assert.Equal(t, 8, c.Len())
+	bytes, writes := c.Dropped()
+	assert.Zero(t, bytes)
+	assert.Zero(t, writes)
+}
+
+func TestRingBufferLimitDropNewest(t *testing.T) {
+	c := New(4)
+	c.SetLimit(10, DropNewest)
+	c.Write([]byte("abcdefgh"))
+	n, err := c.Write([]byte("ijk"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	n, err = c.Write([]byte("lm"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	b := make([]byte, 20)
+	n, err = c.Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdefghlm", string(b[:n]))
+	bytes, writes := c.Dropped()
+	assert.Equal(t, 3, bytes)
+	assert.Equal(t, 1, writes)
+	// the counts reset after they're read
+	bytes, writes = c.Dropped()
+	assert.Zero(t, bytes)
+	assert.Zero(t, writes)
+}
+
+func TestRingBufferLimitDropOldest(t *testing.T) {
+	c := New(4)
+	c.SetLimit(10, DropOldest)
+	c.Write([]byte("abcdefgh"))
+	n, err := c.Write([]byte("ijk"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 10, c.Len())
+	// bigger than the whole limit
+	n, err = c.Write([]byte("0123456789ABC"))
+	assert.Nil(t, err)
+	assert.Equal(t, 13, n)
+	b := make([]byte, 20)
+	n, err = c.Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, "3456789ABC", string(b[:n]))
+	bytes, writes := c.Dropped()
+	assert.Equal(t, 1+10+3, bytes)
+	assert.Equal(t, 2, writes)
+}
+
+func TestRingBufferLimitBlock(t *testing.T) {
+	c := New(4)
+	c.SetLimit(10, Block)
+	c.Write([]byte("abcdefgh"))
+
+	wrote := make(chan int)
+	go func() {
+		n, err := c.Write([]byte("ijklmnopqrstuvwxyz"))
+		assert.Nil(t, err)
+		wrote <- n
+	}()
+
+	received := make([]byte, 0)
+	b := make([]byte, 3)
+	for len(received) < 26 {
+		n, err := c.Read(b)
+		assert.Nil(t, err)
+		assert.True(t, c.Len() <= 10)
+		received = append(received, b[:n]...)
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 18, <-wrote)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", string(received))
+	assert.Equal(t, 10, c.Capacity())
+}
+
+func TestRingBufferLimitBlockClose(t *testing.T) {
+	c := New(10)
+	c.SetLimit(10, Block)
+	c.Write([]byte("0123456789"))
+
+	result := make(chan error)
+	go func() {
+		_, err := c.Write([]byte("more"))
+		result <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+	assert.Equal(t, io.EOF, <-result)
+}
+
+func TestRingBufferNotify(t *testing.T) {
+	c := New(4)
+	c.SetLimit(10, DropNewest)
+	var notes [][2]int
+	c.SetNotify(func(written, dropped int) { notes = append(notes, [2]int{written, dropped}) })
+	c.Write([]byte("abc"))
+	c.Write([]byte(""))
+	c.Write([]byte("defgh"))
+	c.Write([]byte("ijklmnop"))
+	c.Read(make([]byte, 4))
+	c.Write([]byte("q"))
+	assert.Equal(t, [][2]int{{3, 0}, {5, 0}, {0, 8}, {1, 0}}, notes)
+
+	// DropOldest reports what it throws away before what it writes
+	c = New(4)
+	c.SetLimit(10, DropOldest)
+	notes = nil
+	c.SetNotify(func(written, dropped int) { notes = append(notes, [2]int{written, dropped}) })
+	c.Write([]byte("abcdefgh"))
+	c.Write([]byte("ijklmnopqrstuvwxyz"))
+	assert.Equal(t, [][2]int{{8, 0}, {0, 16}, {10, 0}}, notes)
+}
@@ -0,0 +1,186 @@
+package runner
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ndau/writers/pkg/bufio"
+	"github.com/ndau/writers/pkg/filter"
+)
+
+// Stream describes how one of a process's output streams is turned into records.
+// A nil Splitter means bufio.ScanLines, and no Interpreters means a single
+// filter.LastChanceInterpreter, so that by default each line of output becomes
+// a record with the line in _other.
+type Stream struct {
+	Splitter     bufio.SplitFunc
+	Interpreters []filter.Interpreter
+	Options      []filter.Option
+}
+
+// Process is a command whose stdout and stderr are each being passed through a
+// filter.Filter, with the records from both going to the same Sink.
+//
+// Every record is tagged with the stream it came from ("stdout" or "stderr"), the
+// pid of the process, and the name of the command. When the process exits, both
+// filters are drained and closed, and then one final record reports the exit status
+// and how long the process ran for.
+//
+// Calls to the Sink are serialized, so it doesn't need to be safe for concurrent use.
+type Process struct {
+	Cmd *exec.Cmd
+
+	name   string
+	mutex  sync.Mutex
+	sink   filter.Sink
+	stdout *filter.Filter
+	stderr *filter.Filter
+	start  time.Time
+}
+
+// Start wires cmd's stdout and stderr through filters built according to the
+// given Streams, sending all the records to sink, and starts it. Once Start has
+// succeeded, the Process owns the sink, and closes it in Wait.
+// cmd.Stdout and cmd.Stderr must not already be set.
+func Start(cmd *exec.Cmd, sink filter.Sink, stdout Stream, stderr Stream) (*Process, error) {
+	p := &Process{
+		Cmd:  cmd,
+		name: filepath.Base(cmd.Path),
+		sink: sink,
+	}
+	p.stdout = p.newFilter("stdout", stdout)
+	p.stderr = p.newFilter("stderr", stderr)
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+
+	p.start = time.Now()
+	if err := cmd.Start(); err != nil {
+		// nothing was ever written, so these just shut down the goroutines
+		p.stdout.Close()
+		p.stderr.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Run starts cmd as Start does, and then waits for it to finish.
+func Run(cmd *exec.Cmd, sink filter.Sink, stdout Stream, stderr Stream) error {
+	p, err := Start(cmd, sink, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+// Wait waits for the process to exit and for everything it wrote to be
+// processed, emits the final exit record, and then flushes and closes the sink.
+//
+// The error is the one returned by cmd.Wait if there was one (an *exec.ExitError
+// if the process exited unsuccessfully), or otherwise the first error from either
+// filter or from the sink.
+func (p *Process) Wait() error {
+	err := p.Cmd.Wait()
+	duration := time.Since(p.start)
+
+	// cmd.Wait doesn't return until everything the process wrote has been
+	// copied into the filters, so closing them now loses nothing.
+	errs := []error{
+		err,
+		p.stdout.Close(),
+		p.stderr.Close(),
+	}
+
+	record := p.tags(map[string]interface{}{
+		"module":      "runner",
+		"level":       "info",
+		"msg":         "process exited",
+		"exit_code":   p.Cmd.ProcessState.ExitCode(),
+		"duration":    duration.String(),
+		"duration_ns": duration.Nanoseconds(),
+	})
+	if err != nil {
+		record["level"] = "error"
+		record["error"] = err.Error()
+	}
+	p.mutex.Lock()
+	errs = append(errs,
+		p.sink.Emit(record),
+		p.sink.Flush(),
+		p.sink.Close(),
+	)
+	p.mutex.Unlock()
+
+	for _, e := range errs {
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// newFilter builds the filter for one of the process's streams.
+func (p *Process) newFilter(name string, s Stream) *filter.Filter {
+	splitter := s.Splitter
+	if splitter == nil {
+		splitter = bufio.ScanLines
+	}
+	terps := s.Interpreters
+	if len(terps) == 0 {
+		terps = []filter.Interpreter{filter.LastChanceInterpreter{}}
+	}
+	opts := append([]filter.Option{filter.WithInterpreters(terps...)}, s.Options...)
+	return filter.NewWithSink(splitter, &streamSink{p: p, stream: name}, opts...)
+}
+
+// tags adds the fields that identify the process to a record.
+func (p *Process) tags(fields map[string]interface{}) map[string]interface{} {
+	fields["cmd"] = p.name
+	// os/exec sets Process before it starts copying output, so this is safe
+	// from the filters' goroutines
+	if p.Cmd.Process != nil {
+		fields["pid"] = p.Cmd.Process.Pid
+	}
+	return fields
+}
+
+// streamSink tags the records from one stream and passes them to the process's sink.
+// It doesn't close the process's sink, since the other stream is still using it.
+type streamSink struct {
+	p      *Process
+	stream string
+}
+
+var _ filter.Sink = (*streamSink)(nil)
+
+// Emit implements filter.Sink for streamSink
+func (s *streamSink) Emit(fields map[string]interface{}) error {
+	fields = s.p.tags(fields)
+	fields["stream"] = s.stream
+	s.p.mutex.Lock()
+	defer s.p.mutex.Unlock()
+	return s.p.sink.Emit(fields)
+}
+
+// Flush implements filter.Sink for streamSink
+func (s *streamSink) Flush() error {
+	s.p.mutex.Lock()
+	defer s.p.mutex.Unlock()
+	return s.p.sink.Flush()
+}
+
+// Close implements filter.Sink for streamSink
+func (s *streamSink) Close() error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package runner
+
+// ----- ---- --- -- -
+// Copyright 2019, 2020 The Axiom Foundation. All Rights Reserved.
+//
+// Licensed under the Apache License 2.0 (the "License").  You may not use
+// this file except in compliance with the License.  You can obtain a copy
+// in the file LICENSE in the source distribution or at
+// https://www.apache.org/licenses/LICENSE-2.0.txt
+// - -- --- ---- -----
+
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/ndau/writers/pkg/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collect returns a sink that appends to ma; Process serializes calls to it
+func collect(ma *[]map[string]interface{}) filter.Sink {
+	return filter.OutputFunc(func(m map[string]interface{}) {
+		*ma = append(*ma, m)
+	})
+}
+
+func byStream(ma []map[string]interface{}, stream string) []map[string]interface{} {
+	out := []map[string]interface{}{}
+	for _, m := range ma {
+		if m["stream"] == stream {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func TestRunLines(t *testing.T) {
+	ma := []map[string]interface{}{}
+	cmd := exec.Command("sh", "-c", "echo one; echo oops >&2; echo two; exit 3")
+	err := Run(cmd, collect(&ma), Stream{}, Stream{})
+	require.IsType(t, &exec.ExitError{}, err)
+
+	require.Equal(t, 4, len(ma))
+	stdout := byStream(ma, "stdout")
+	require.Equal(t, 2, len(stdout))
+	assert.Equal(t, "one", stdout[0]["_other"])
+	assert.Equal(t, "two", stdout[1]["_other"])
+	stderr := byStream(ma, "stderr")
+	require.Equal(t, 1, len(stderr))
+	assert.Equal(t, "oops", stderr[0]["_other"])
+
+	pid := cmd.Process.Pid
+	for _, m := range ma {
+		assert.Equal(t, "sh", m["cmd"])
+		assert.Equal(t, pid, m["pid"])
+	}
+
+	// the exit record always comes last
+	last := ma[3]
+	assert.Equal(t, "runner", last["module"])
+	assert.Equal(t, "error", last["level"])
+	assert.Equal(t, 3, last["exit_code"])
+	assert.NotNil(t, last["duration"])
+	assert.NotContains(t, last, "stream")
+}
+
+func TestRunJSON(t *testing.T) {
+	ma := []map[string]interface{}{}
+	cmd := exec.Command("sh", "-c", `printf '{"a":1}{"a":2}{"a":'`)
+	err := Run(cmd, collect(&ma),
+		Stream{Splitter: filter.JSONSplit, Interpreters: []filter.Interpreter{filter.JSONInterpreter{}}},
+		Stream{},
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, 4, len(ma))
+	assert.Equal(t, 1.0, ma[0]["a"])
+	assert.Equal(t, 2.0, ma[1]["a"])
+	// the unfinished object still makes it out when the process exits
+	assert.Equal(t, `{"a":`, ma[2]["_msg"])
+	assert.Equal(t, "info", ma[3]["level"])
+	assert.Equal(t, 0, ma[3]["exit_code"])
+}
+
+func TestStartFails(t *testing.T) {
+	ma := []map[string]interface{}{}
+	_, err := Start(exec.Command("/no/such/command"), collect(&ma), Stream{}, Stream{})
+	assert.Error(t, err)
+	assert.Empty(t, ma)
+}